@@ -0,0 +1,53 @@
+package slash
+
+// Colors that Slack recognizes for the color bar of an Attachment. Any hex
+// color code, like "#439FE0", can also be used.
+const (
+	ColorGood    = "good"
+	ColorWarning = "warning"
+	ColorDanger  = "danger"
+)
+
+// Attachment is a legacy message attachment, which renders secondary content
+// with a colored bar alongside it.
+// See https://api.slack.com/reference/messaging/attachments
+type Attachment struct {
+	// A plain text summary, shown in clients that can't render attachments.
+	Fallback string `json:"fallback,omitempty"`
+	Color    string `json:"color,omitempty"`
+	Pretext  string `json:"pretext,omitempty"`
+
+	AuthorName string `json:"author_name,omitempty"`
+	AuthorLink string `json:"author_link,omitempty"`
+	AuthorIcon string `json:"author_icon,omitempty"`
+
+	Title     string `json:"title,omitempty"`
+	TitleLink string `json:"title_link,omitempty"`
+	Text      string `json:"text,omitempty"`
+
+	Fields []AttachmentField `json:"fields,omitempty"`
+
+	ImageURL string `json:"image_url,omitempty"`
+	ThumbURL string `json:"thumb_url,omitempty"`
+
+	Footer     string `json:"footer,omitempty"`
+	FooterIcon string `json:"footer_icon,omitempty"`
+
+	// Ts is a unix timestamp that's displayed in the footer.
+	Ts int64 `json:"ts,omitempty"`
+
+	// MrkdwnIn lists the fields that should be formatted with mrkdwn, for
+	// example "text", "pretext" and "fields".
+	MrkdwnIn []string `json:"mrkdwn_in,omitempty"`
+}
+
+// AttachmentField is a field that's displayed in a table inside of an
+// Attachment.
+type AttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+
+	// Short indicates that the field is short enough to be displayed
+	// side-by-side with other fields.
+	Short bool `json:"short,omitempty"`
+}
@@ -0,0 +1,49 @@
+package slash
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttachment_MarshalJSON(t *testing.T) {
+	resp := Say("Deployed")
+	resp.Attachments = []Attachment{
+		{
+			Fallback: "Deployed acme-inc to staging",
+			Color:    ColorGood,
+			Pretext:  "Deploy finished",
+			Title:    "acme-inc",
+			Fields: []AttachmentField{
+				{Title: "Environment", Value: "staging", Short: true},
+				{Title: "Ref", Value: "master"},
+			},
+			Footer:   "slash",
+			Ts:       1451606400,
+			MrkdwnIn: []string{"text"},
+		},
+	}
+
+	raw, err := json.Marshal(newResponse(resp))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"response_type": "in_channel",
+		"text": "Deployed",
+		"attachments": [
+			{
+				"fallback": "Deployed acme-inc to staging",
+				"color": "good",
+				"pretext": "Deploy finished",
+				"title": "acme-inc",
+				"fields": [
+					{"title": "Environment", "value": "staging", "short": true},
+					{"title": "Ref", "value": "master"}
+				],
+				"footer": "slash",
+				"ts": 1451606400,
+				"mrkdwn_in": ["text"]
+			}
+		]
+	}`, string(raw))
+}
@@ -0,0 +1,492 @@
+package slash
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits defined in https://api.slack.com/reference/block-kit
+const (
+	// A single message can contain at most 50 blocks.
+	MaximumBlocks = 50
+
+	maxActionIDLength     = 255
+	maxSectionTextLength  = 3000
+	maxSectionFields      = 10
+	maxSectionFieldLength = 2000
+	maxHeaderTextLength   = 150
+	maxContextElements    = 10
+	maxActionsElements    = 25
+	maxImageURLLength     = 3000
+	maxAltTextLength      = 2000
+	maxButtonTextLength   = 75
+	maxButtonValueLength  = 2000
+	maxButtonURLLength    = 3000
+	maxPlaceholderLength  = 150
+	maxOptionTextLength   = 75
+	maxOptionValueLength  = 150
+	maxSelectOptions      = 100
+	minOverflowOptions    = 2
+	maxOverflowOptions    = 5
+)
+
+// The format of dates used by date pickers.
+const datePickerLayout = "2006-01-02"
+
+// Types of text objects.
+const (
+	PlainTextType = "plain_text"
+	MarkdownType  = "mrkdwn"
+)
+
+// Styles for buttons.
+const (
+	ButtonPrimary = "primary"
+	ButtonDanger  = "danger"
+)
+
+// Types of select menus.
+const (
+	StaticSelect        = "static_select"
+	ExternalSelect      = "external_select"
+	UsersSelect         = "users_select"
+	ConversationsSelect = "conversations_select"
+	ChannelsSelect      = "channels_select"
+)
+
+// Block represents a Block Kit layout block that can be sent in a Response.
+// See https://api.slack.com/reference/block-kit/blocks
+type Block interface {
+	BlockType() string
+}
+
+// Element represents an interactive Block Kit element, which can be used as
+// the accessory of a section, or inside of an actions block.
+// See https://api.slack.com/reference/block-kit/block-elements
+type Element interface {
+	ElementType() string
+}
+
+// ContextElement is something that can be included in a context block, which
+// is either a TextObject or an ImageElement.
+type ContextElement interface {
+	contextElement()
+}
+
+// TextObject is a Block Kit text composition object.
+type TextObject struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Emoji    bool   `json:"emoji,omitempty"`
+	Verbatim bool   `json:"verbatim,omitempty"`
+}
+
+// PlainText returns a new plain_text TextObject.
+func PlainText(text string) *TextObject {
+	return &TextObject{Type: PlainTextType, Text: text}
+}
+
+// Markdown returns a new mrkdwn TextObject.
+func Markdown(text string) *TextObject {
+	return &TextObject{Type: MarkdownType, Text: text}
+}
+
+func (*TextObject) contextElement() {}
+
+// SectionBlock is a section block, which displays text, fields and an optional
+// accessory element.
+type SectionBlock struct {
+	Text      *TextObject   `json:"text,omitempty"`
+	Fields    []*TextObject `json:"fields,omitempty"`
+	Accessory Element       `json:"accessory,omitempty"`
+	BlockID   string        `json:"block_id,omitempty"`
+}
+
+// NewSection returns a new SectionBlock. At least one of text or fields must be
+// provided.
+func NewSection(text *TextObject, fields ...*TextObject) (*SectionBlock, error) {
+	if text == nil && len(fields) == 0 {
+		return nil, blockError("section", "text or fields are required")
+	}
+	if text != nil {
+		if err := checkLength("section", "text", text.Text, maxSectionTextLength); err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) > maxSectionFields {
+		return nil, blockError("section", "can have at most %d fields", maxSectionFields)
+	}
+	for _, f := range fields {
+		if f == nil {
+			return nil, blockError("section", "fields can't be nil")
+		}
+		if err := checkLength("section", "field", f.Text, maxSectionFieldLength); err != nil {
+			return nil, err
+		}
+	}
+	return &SectionBlock{Text: text, Fields: fields}, nil
+}
+
+func (b *SectionBlock) BlockType() string { return "section" }
+
+func (b *SectionBlock) MarshalJSON() ([]byte, error) {
+	type t SectionBlock
+	return marshalWithType(b.BlockType(), (*t)(b))
+}
+
+// DividerBlock is a divider block, which visually separates other blocks.
+type DividerBlock struct {
+	BlockID string `json:"block_id,omitempty"`
+}
+
+// NewDivider returns a new DividerBlock.
+func NewDivider() *DividerBlock {
+	return &DividerBlock{}
+}
+
+func (b *DividerBlock) BlockType() string { return "divider" }
+
+func (b *DividerBlock) MarshalJSON() ([]byte, error) {
+	type t DividerBlock
+	return marshalWithType(b.BlockType(), (*t)(b))
+}
+
+// HeaderBlock is a header block, which displays plain text in a larger font.
+type HeaderBlock struct {
+	Text    *TextObject `json:"text"`
+	BlockID string      `json:"block_id,omitempty"`
+}
+
+// NewHeader returns a new HeaderBlock.
+func NewHeader(text string) (*HeaderBlock, error) {
+	if err := checkRequired("header", "text", text, maxHeaderTextLength); err != nil {
+		return nil, err
+	}
+	return &HeaderBlock{Text: PlainText(text)}, nil
+}
+
+func (b *HeaderBlock) BlockType() string { return "header" }
+
+func (b *HeaderBlock) MarshalJSON() ([]byte, error) {
+	type t HeaderBlock
+	return marshalWithType(b.BlockType(), (*t)(b))
+}
+
+// ContextBlock is a context block, which displays small text and images.
+type ContextBlock struct {
+	Elements []ContextElement `json:"elements"`
+	BlockID  string           `json:"block_id,omitempty"`
+}
+
+// NewContext returns a new ContextBlock.
+func NewContext(elements ...ContextElement) (*ContextBlock, error) {
+	if len(elements) == 0 || len(elements) > maxContextElements {
+		return nil, blockError("context", "must have between 1 and %d elements", maxContextElements)
+	}
+	return &ContextBlock{Elements: elements}, nil
+}
+
+func (b *ContextBlock) BlockType() string { return "context" }
+
+func (b *ContextBlock) MarshalJSON() ([]byte, error) {
+	type t ContextBlock
+	return marshalWithType(b.BlockType(), (*t)(b))
+}
+
+// ActionsBlock is an actions block, which holds interactive elements.
+type ActionsBlock struct {
+	Elements []Element `json:"elements"`
+	BlockID  string    `json:"block_id,omitempty"`
+}
+
+// NewActions returns a new ActionsBlock.
+func NewActions(elements ...Element) (*ActionsBlock, error) {
+	if len(elements) == 0 || len(elements) > maxActionsElements {
+		return nil, blockError("actions", "must have between 1 and %d elements", maxActionsElements)
+	}
+	return &ActionsBlock{Elements: elements}, nil
+}
+
+func (b *ActionsBlock) BlockType() string { return "actions" }
+
+func (b *ActionsBlock) MarshalJSON() ([]byte, error) {
+	type t ActionsBlock
+	return marshalWithType(b.BlockType(), (*t)(b))
+}
+
+// ImageBlock is an image block, which displays an image.
+type ImageBlock struct {
+	ImageURL string      `json:"image_url"`
+	AltText  string      `json:"alt_text"`
+	Title    *TextObject `json:"title,omitempty"`
+	BlockID  string      `json:"block_id,omitempty"`
+}
+
+// NewImage returns a new ImageBlock.
+func NewImage(imageURL, altText string) (*ImageBlock, error) {
+	if err := checkRequired("image", "image_url", imageURL, maxImageURLLength); err != nil {
+		return nil, err
+	}
+	if err := checkRequired("image", "alt_text", altText, maxAltTextLength); err != nil {
+		return nil, err
+	}
+	return &ImageBlock{ImageURL: imageURL, AltText: altText}, nil
+}
+
+func (b *ImageBlock) BlockType() string { return "image" }
+
+func (b *ImageBlock) MarshalJSON() ([]byte, error) {
+	type t ImageBlock
+	return marshalWithType(b.BlockType(), (*t)(b))
+}
+
+// ImageElement is an image element, which can be used in a context block or
+// as the accessory of a section.
+type ImageElement struct {
+	ImageURL string `json:"image_url"`
+	AltText  string `json:"alt_text"`
+}
+
+// NewImageElement returns a new ImageElement.
+func NewImageElement(imageURL, altText string) (*ImageElement, error) {
+	if err := checkRequired("image", "image_url", imageURL, maxImageURLLength); err != nil {
+		return nil, err
+	}
+	if err := checkRequired("image", "alt_text", altText, maxAltTextLength); err != nil {
+		return nil, err
+	}
+	return &ImageElement{ImageURL: imageURL, AltText: altText}, nil
+}
+
+func (e *ImageElement) ElementType() string { return "image" }
+
+func (e *ImageElement) MarshalJSON() ([]byte, error) {
+	type t ImageElement
+	return marshalWithType(e.ElementType(), (*t)(e))
+}
+
+func (*ImageElement) contextElement() {}
+
+// ButtonElement is a button element.
+type ButtonElement struct {
+	Text     *TextObject `json:"text"`
+	ActionID string      `json:"action_id"`
+	URL      string      `json:"url,omitempty"`
+	Value    string      `json:"value,omitempty"`
+	Style    string      `json:"style,omitempty"`
+}
+
+// NewButton returns a new ButtonElement.
+func NewButton(actionID, text string) (*ButtonElement, error) {
+	if err := checkRequired("button", "action_id", actionID, maxActionIDLength); err != nil {
+		return nil, err
+	}
+	if err := checkRequired("button", "text", text, maxButtonTextLength); err != nil {
+		return nil, err
+	}
+	return &ButtonElement{ActionID: actionID, Text: PlainText(text)}, nil
+}
+
+// WithValue sets the value that's sent in the interaction payload.
+func (e *ButtonElement) WithValue(value string) (*ButtonElement, error) {
+	if err := checkLength("button", "value", value, maxButtonValueLength); err != nil {
+		return nil, err
+	}
+	e.Value = value
+	return e, nil
+}
+
+// WithURL sets a URL that will be opened when the button is clicked.
+func (e *ButtonElement) WithURL(url string) (*ButtonElement, error) {
+	if err := checkLength("button", "url", url, maxButtonURLLength); err != nil {
+		return nil, err
+	}
+	e.URL = url
+	return e, nil
+}
+
+func (e *ButtonElement) ElementType() string { return "button" }
+
+func (e *ButtonElement) MarshalJSON() ([]byte, error) {
+	type t ButtonElement
+	return marshalWithType(e.ElementType(), (*t)(e))
+}
+
+// Option is an option in a select menu or overflow menu.
+type Option struct {
+	Text        *TextObject `json:"text"`
+	Value       string      `json:"value"`
+	Description *TextObject `json:"description,omitempty"`
+}
+
+// NewOption returns a new Option.
+func NewOption(text, value string) (*Option, error) {
+	if err := checkRequired("option", "text", text, maxOptionTextLength); err != nil {
+		return nil, err
+	}
+	if err := checkRequired("option", "value", value, maxOptionValueLength); err != nil {
+		return nil, err
+	}
+	return &Option{Text: PlainText(text), Value: value}, nil
+}
+
+// SelectElement is a select menu element. The Type determines where the
+// options come from, and Options is only used for static selects.
+type SelectElement struct {
+	Type          string      `json:"type"`
+	Placeholder   *TextObject `json:"placeholder,omitempty"`
+	ActionID      string      `json:"action_id"`
+	Options       []*Option   `json:"options,omitempty"`
+	InitialOption *Option     `json:"initial_option,omitempty"`
+}
+
+// NewStaticSelect returns a new static_select SelectElement with the given
+// options.
+func NewStaticSelect(actionID, placeholder string, options ...*Option) (*SelectElement, error) {
+	if len(options) == 0 || len(options) > maxSelectOptions {
+		return nil, blockError(StaticSelect, "must have between 1 and %d options", maxSelectOptions)
+	}
+	e, err := NewSelect(StaticSelect, actionID, placeholder)
+	if err != nil {
+		return nil, err
+	}
+	e.Options = options
+	return e, nil
+}
+
+// NewSelect returns a new SelectElement of the given type, such as UsersSelect
+// or ConversationsSelect.
+func NewSelect(typ, actionID, placeholder string) (*SelectElement, error) {
+	if err := checkRequired(typ, "action_id", actionID, maxActionIDLength); err != nil {
+		return nil, err
+	}
+	if err := checkLength(typ, "placeholder", placeholder, maxPlaceholderLength); err != nil {
+		return nil, err
+	}
+	e := &SelectElement{Type: typ, ActionID: actionID}
+	if placeholder != "" {
+		e.Placeholder = PlainText(placeholder)
+	}
+	return e, nil
+}
+
+func (e *SelectElement) ElementType() string { return e.Type }
+
+// OverflowElement is an overflow menu element.
+type OverflowElement struct {
+	ActionID string    `json:"action_id"`
+	Options  []*Option `json:"options"`
+}
+
+// NewOverflow returns a new OverflowElement.
+func NewOverflow(actionID string, options ...*Option) (*OverflowElement, error) {
+	if err := checkRequired("overflow", "action_id", actionID, maxActionIDLength); err != nil {
+		return nil, err
+	}
+	if len(options) < minOverflowOptions || len(options) > maxOverflowOptions {
+		return nil, blockError("overflow", "must have between %d and %d options", minOverflowOptions, maxOverflowOptions)
+	}
+	return &OverflowElement{ActionID: actionID, Options: options}, nil
+}
+
+func (e *OverflowElement) ElementType() string { return "overflow" }
+
+func (e *OverflowElement) MarshalJSON() ([]byte, error) {
+	type t OverflowElement
+	return marshalWithType(e.ElementType(), (*t)(e))
+}
+
+// DatePickerElement is a date picker element.
+type DatePickerElement struct {
+	ActionID    string      `json:"action_id"`
+	Placeholder *TextObject `json:"placeholder,omitempty"`
+	InitialDate string      `json:"initial_date,omitempty"`
+}
+
+// NewDatePicker returns a new DatePickerElement. If initial is not the zero
+// time, it will be the date that's initially selected.
+func NewDatePicker(actionID, placeholder string, initial time.Time) (*DatePickerElement, error) {
+	if err := checkRequired("datepicker", "action_id", actionID, maxActionIDLength); err != nil {
+		return nil, err
+	}
+	if err := checkLength("datepicker", "placeholder", placeholder, maxPlaceholderLength); err != nil {
+		return nil, err
+	}
+	e := &DatePickerElement{ActionID: actionID}
+	if placeholder != "" {
+		e.Placeholder = PlainText(placeholder)
+	}
+	if !initial.IsZero() {
+		e.InitialDate = initial.Format(datePickerLayout)
+	}
+	return e, nil
+}
+
+func (e *DatePickerElement) ElementType() string { return "datepicker" }
+
+func (e *DatePickerElement) MarshalJSON() ([]byte, error) {
+	type t DatePickerElement
+	return marshalWithType(e.ElementType(), (*t)(e))
+}
+
+// BlockError is returned when a block or element violates one of Slack's
+// limits.
+type BlockError struct {
+	// The type of block or element.
+	Type    string
+	Message string
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("slash: invalid %s: %s", e.Type, e.Message)
+}
+
+func blockError(typ, format string, args ...interface{}) error {
+	return &BlockError{Type: typ, Message: fmt.Sprintf(format, args...)}
+}
+
+// checkLength checks that the value is no longer than max characters.
+func checkLength(typ, field, value string, max int) error {
+	if utf8.RuneCountInString(value) > max {
+		return blockError(typ, "%s can be at most %d characters", field, max)
+	}
+	return nil
+}
+
+// checkRequired checks that the value is present, and no longer than max
+// characters.
+func checkRequired(typ, field, value string, max int) error {
+	if value == "" {
+		return blockError(typ, "%s is required", field)
+	}
+	return checkLength(typ, field, value, max)
+}
+
+// checkBlocks checks that the number of blocks is within the limit for a
+// single message.
+func checkBlocks(blocks []Block) error {
+	if len(blocks) > MaximumBlocks {
+		return blockError("message", "can have at most %d blocks", MaximumBlocks)
+	}
+	return nil
+}
+
+// marshalWithType marshals v, which must marshal to a JSON object, with an
+// added "type" field.
+func marshalWithType(typ string, v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"type":%q`, typ)
+	if len(raw) > 2 {
+		b.WriteByte(',')
+	}
+	b.Write(raw[1:])
+	return b.Bytes(), nil
+}
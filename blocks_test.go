@@ -0,0 +1,148 @@
+package slash
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlocks_MarshalJSON(t *testing.T) {
+	header, err := NewHeader("Deploy")
+	assert.NoError(t, err)
+
+	button, err := NewButton("approve", "Approve")
+	assert.NoError(t, err)
+	button.Style = ButtonPrimary
+	button, err = button.WithValue("acme-inc")
+	assert.NoError(t, err)
+
+	option, err := NewOption("Staging", "staging")
+	assert.NoError(t, err)
+	sel, err := NewStaticSelect("environment", "Environment", option)
+	assert.NoError(t, err)
+
+	other, err := NewOption("Production", "production")
+	assert.NoError(t, err)
+	overflow, err := NewOverflow("more", option, other)
+	assert.NoError(t, err)
+
+	date, err := NewDatePicker("date", "", time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+
+	actions, err := NewActions(button, sel, overflow, date)
+	assert.NoError(t, err)
+
+	section, err := NewSection(Markdown("*acme-inc*"), PlainText("a"), PlainText("b"))
+	assert.NoError(t, err)
+	image, err := NewImageElement("https://example.com/a.png", "a")
+	assert.NoError(t, err)
+	section.Accessory = image
+
+	context, err := NewContext(Markdown("by <@U012A012A>"), image)
+	assert.NoError(t, err)
+
+	img, err := NewImage("https://example.com/b.png", "b")
+	assert.NoError(t, err)
+
+	resp, err := ReplyBlocks("Deploy", header, section, NewDivider(), context, actions, img)
+	assert.NoError(t, err)
+
+	raw, err := json.Marshal(newResponse(resp))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"text": "Deploy",
+		"blocks": [
+			{"type": "header", "text": {"type": "plain_text", "text": "Deploy"}},
+			{
+				"type": "section",
+				"text": {"type": "mrkdwn", "text": "*acme-inc*"},
+				"fields": [{"type": "plain_text", "text": "a"}, {"type": "plain_text", "text": "b"}],
+				"accessory": {"type": "image", "image_url": "https://example.com/a.png", "alt_text": "a"}
+			},
+			{"type": "divider"},
+			{
+				"type": "context",
+				"elements": [
+					{"type": "mrkdwn", "text": "by <@U012A012A>"},
+					{"type": "image", "image_url": "https://example.com/a.png", "alt_text": "a"}
+				]
+			},
+			{
+				"type": "actions",
+				"elements": [
+					{"type": "button", "action_id": "approve", "text": {"type": "plain_text", "text": "Approve"}, "value": "acme-inc", "style": "primary"},
+					{
+						"type": "static_select",
+						"action_id": "environment",
+						"placeholder": {"type": "plain_text", "text": "Environment"},
+						"options": [{"text": {"type": "plain_text", "text": "Staging"}, "value": "staging"}]
+					},
+					{
+						"type": "overflow",
+						"action_id": "more",
+						"options": [
+							{"text": {"type": "plain_text", "text": "Staging"}, "value": "staging"},
+							{"text": {"type": "plain_text", "text": "Production"}, "value": "production"}
+						]
+					},
+					{"type": "datepicker", "action_id": "date", "initial_date": "2016-01-02"}
+				]
+			},
+			{"type": "image", "image_url": "https://example.com/b.png", "alt_text": "b"}
+		]
+	}`, string(raw))
+}
+
+func TestBlocks_Validation(t *testing.T) {
+	tests := []struct {
+		err error
+		msg string
+	}{
+		{second(NewSection(nil)), "slash: invalid section: text or fields are required"},
+		{second(NewSection(Markdown(strings.Repeat("a", 3001)))), "slash: invalid section: text can be at most 3000 characters"},
+		{second(NewSection(nil, make([]*TextObject, 11)...)), "slash: invalid section: can have at most 10 fields"},
+		{second(NewSection(nil, PlainText("a"), nil)), "slash: invalid section: fields can't be nil"},
+		{second(NewHeader("")), "slash: invalid header: text is required"},
+		{second(NewHeader(strings.Repeat("a", 151))), "slash: invalid header: text can be at most 150 characters"},
+		{second(NewContext()), "slash: invalid context: must have between 1 and 10 elements"},
+		{second(NewActions()), "slash: invalid actions: must have between 1 and 25 elements"},
+		{second(NewImage("https://example.com/a.png", "")), "slash: invalid image: alt_text is required"},
+		{second(NewButton("approve", strings.Repeat("a", 76))), "slash: invalid button: text can be at most 75 characters"},
+		{second(NewOption("a", "")), "slash: invalid option: value is required"},
+		{second(NewStaticSelect("environment", "Environment")), "slash: invalid static_select: must have between 1 and 100 options"},
+		{second(NewSelect(UsersSelect, "", "User")), "slash: invalid users_select: action_id is required"},
+		{second(NewOverflow("more", &Option{})), "slash: invalid overflow: must have between 2 and 5 options"},
+		{second(NewDatePicker("", "", time.Time{})), "slash: invalid datepicker: action_id is required"},
+	}
+
+	for _, tt := range tests {
+		assert.EqualError(t, tt.err, tt.msg)
+	}
+}
+
+func TestReplyBlocks_TooManyBlocks(t *testing.T) {
+	blocks := make([]Block, MaximumBlocks+1)
+	for i := range blocks {
+		blocks[i] = NewDivider()
+	}
+
+	_, err := ReplyBlocks("", blocks...)
+	assert.EqualError(t, err, "slash: invalid message: can have at most 50 blocks")
+	assert.IsType(t, &BlockError{}, err)
+
+	_, err = SayBlocks("", blocks...)
+	assert.EqualError(t, err, "slash: invalid message: can have at most 50 blocks")
+
+	resp, err := SayBlocks("", blocks[:MaximumBlocks]...)
+	assert.NoError(t, err)
+	assert.True(t, resp.InChannel)
+	assert.Len(t, resp.Blocks, MaximumBlocks)
+}
+
+// second returns the error from a constructor.
+func second(_ interface{}, err error) error {
+	return err
+}
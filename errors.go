@@ -0,0 +1,89 @@
+package slash
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrMethodNotAllowed is returned by Server when the request method
+	// isn't POST.
+	ErrMethodNotAllowed error = &Error{
+		Status:  http.StatusMethodNotAllowed,
+		Message: "Method not allowed.",
+		Err:     errors.New("slash: method not allowed"),
+	}
+
+	// ErrUnsupportedMediaType is returned by Server when the request body
+	// isn't application/x-www-form-urlencoded.
+	ErrUnsupportedMediaType error = &Error{
+		Status:  http.StatusUnsupportedMediaType,
+		Message: "Unsupported media type.",
+		Err:     errors.New("slash: unsupported media type"),
+	}
+)
+
+// Error is an error with an http status code, and a message that's safe to
+// show to the user.
+type Error struct {
+	// Status is the http status code to respond with, if the error occurs
+	// before the command is dispatched.
+	Status int
+
+	// Message is the message that's shown to the user.
+	Message string
+
+	// Err is the underlying error, which may contain internal details.
+	Err error
+}
+
+// Error returns the string of the underlying error, or the Message if there
+// isn't one.
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the http status code for the error. If err is, or wraps,
+// an *Error, its Status is returned, otherwise http.StatusBadRequest.
+func StatusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) && e.Status != 0 {
+		return e.Status
+	}
+	return http.StatusBadRequest
+}
+
+// UserMessage returns the message that should be shown to the user for the
+// error. If err is, or wraps, an *Error, its Message is returned, otherwise the
+// error string.
+func UserMessage(err error) string {
+	var e *Error
+	if errors.As(err, &e) && e.Message != "" {
+		return e.Message
+	}
+	return err.Error()
+}
+
+// DefaultRenderError renders the error with the status code from StatusCode as
+// a plain text body. If err is, or wraps, an *Error, the body is its Message.
+// Otherwise the body is the generic status text, since the error may contain
+// internal details, or input from the request.
+func DefaultRenderError(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusCode(err)
+
+	message := http.StatusText(status)
+	var e *Error
+	if errors.As(err, &e) && e.Message != "" {
+		message = e.Message
+	}
+
+	http.Error(w, message, status)
+}
@@ -0,0 +1,61 @@
+package slash
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError(t *testing.T) {
+	err := &Error{Status: http.StatusForbidden, Message: "Forbidden."}
+	assert.EqualError(t, err, "Forbidden.")
+	assert.Equal(t, http.StatusForbidden, StatusCode(err))
+	assert.Equal(t, "Forbidden.", UserMessage(err))
+
+	boom := errors.New("boom")
+	err = &Error{Message: "Something went wrong.", Err: boom}
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, http.StatusBadRequest, StatusCode(err))
+	assert.Equal(t, "Something went wrong.", UserMessage(err))
+	assert.True(t, errors.Is(err, boom))
+
+	assert.Equal(t, http.StatusBadRequest, StatusCode(boom))
+	assert.Equal(t, "boom", UserMessage(boom))
+}
+
+func TestError_Sentinels(t *testing.T) {
+	assert.EqualError(t, ErrInvalidToken, "slash: invalid token")
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(ErrInvalidToken))
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(ErrInvalidSignature))
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(ErrInvalidTimestamp))
+	assert.Equal(t, http.StatusNotFound, StatusCode(ErrNoHandler))
+	assert.Equal(t, http.StatusBadRequest, StatusCode(&InvalidResponseURLError{}))
+}
+
+func TestError_Wrapped(t *testing.T) {
+	err := fmt.Errorf("validating request: %w", ErrInvalidToken)
+	assert.Equal(t, http.StatusUnauthorized, StatusCode(err))
+	assert.Equal(t, "Unauthorized.", UserMessage(err))
+}
+
+func TestDefaultRenderError(t *testing.T) {
+	resp := httptest.NewRecorder()
+	DefaultRenderError(resp, nil, ErrInvalidToken)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Unauthorized.\n", resp.Body.String())
+
+	resp = httptest.NewRecorder()
+	DefaultRenderError(resp, nil, fmt.Errorf("validating request: %w", ErrInvalidToken))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Unauthorized.\n", resp.Body.String())
+
+	// Errors without a user facing message don't leak their details.
+	resp = httptest.NewRecorder()
+	DefaultRenderError(resp, nil, errors.New("invalid URL escape \"%zz\""))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Bad Request\n", resp.Body.String())
+}
@@ -1,34 +1,44 @@
 package slash_test
 
 import (
+	"fmt"
 	"net/http"
-	"regexp"
 
 	"github.com/ejholmes/slash"
 	"golang.org/x/net/context"
 )
 
 func Example() {
+	// /weather zip 94102
+	// /weather zip 94102 forecast
+	// /weather help
+	zip := slash.NewMux()
+	zip.Pattern("{zip:int}", slash.HandlerFunc(Zipcode)).
+		Describe("Current weather for a zip code.", "", "94102")
+	zip.Pattern("{zip:int} forecast", slash.HandlerFunc(Forecast)).
+		Describe("Forecast for a zip code.", "", "94102 forecast")
+
+	weather := slash.NewMux()
+	weather.Mount("zip", zip)
+	weather.Help()
+
 	r := slash.NewMux()
-	r.Command("/weather", "secrettoken", slash.HandlerFunc(Weather))
+	r.Command("/weather", "secrettoken", weather)
 
 	s := slash.NewServer(r)
 	http.ListenAndServe(":8080", s)
 }
 
-// Weather is the primary slash handler for the /weather command.
-func Weather(ctx context.Context, r slash.Responder, command slash.Command) error {
-	h := slash.NewMux()
-
-	var zipcodeRegex = regexp.MustCompile(`(?P<zip>[0-9])`)
-	h.MatchText(zipcodeRegex, slash.HandlerFunc(Zipcode))
-
-	return h.ServeCommand(ctx, r, command)
-}
-
 // Zipcode is a slash handler that returns the weather for a zip code.
 func Zipcode(ctx context.Context, r slash.Responder, command slash.Command) error {
 	params := slash.Params(ctx)
 	zip := params["zip"]
 	return r.Respond(slash.Reply(zip))
 }
+
+// Forecast is a slash handler that returns the forecast for a zip code.
+func Forecast(ctx context.Context, r slash.Responder, command slash.Command) error {
+	params := slash.Params(ctx)
+	zip := params["zip"]
+	return r.Respond(slash.Reply(fmt.Sprintf("Forecast for %s", zip)))
+}
@@ -16,18 +16,17 @@ func main() {
 }
 
 func Handle(ctx context.Context, r slash.Responder, command slash.Command) error {
-	if err := r.Respond(slash.Reply("Cool beans")); err != nil {
-		return err
-	}
+	p := slash.NewProgress(r)
 
-	for i := 0; i < 4; i++ {
-		<-time.After(time.Second)
-		if err := r.Respond(slash.Reply(fmt.Sprintf("Async response %d", i))); err != nil {
+	for i := 0; i < 10; i++ {
+		if err := p.Update(slash.Reply(fmt.Sprintf("Working... %d/10", i))); err != nil {
 			return err
 		}
+		<-time.After(time.Second)
 	}
 
-	return nil
+	// The result replaces the progress message.
+	return p.Done(slash.Reply("Cool beans"))
 }
 
 func printErrors(h slash.Handler) slash.Handler {
@@ -9,18 +9,39 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
 )
 
 var (
-	// ErrNoHandler is returned by Mux ServeCommand if a Handler isn't found
-	// for the route.
-	ErrNoHandler = errors.New("slash: no handler")
+	// ErrNoHandler is returned by the NoHandler Handler, which can be used
+	// as the NotFound Handler of a Mux.
+	ErrNoHandler error = &Error{
+		Status:  http.StatusNotFound,
+		Message: "Sorry, I don't know how to handle that command.",
+		Err:     errors.New("slash: no handler"),
+	}
 
 	// ErrInvalidToken is returned when the provided token in the request
 	// does not match the expected secret.
-	ErrInvalidToken = errors.New("slash: invalid token")
+	ErrInvalidToken error = &Error{
+		Status:  http.StatusUnauthorized,
+		Message: "Unauthorized.",
+		Err:     errors.New("slash: invalid token"),
+	}
+
+	// ErrTooManyResponses is returned by the delayed Responder when
+	// MaximumDelayedResponses have already been sent.
+	ErrTooManyResponses = fmt.Errorf("slash: a maximum of %d delayed responses can be sent", MaximumDelayedResponses)
+
+	// ErrResponseURLExpired is returned by the delayed Responder when the
+	// command was received more than ResponseURLLifetime ago.
+	ErrResponseURLExpired = errors.New("slash: response_url has expired")
 )
 
 // Responder represents an object that can send Responses.
@@ -28,6 +49,27 @@ type Responder interface {
 	Respond(Response) error
 }
 
+// Budgeted is implemented by Responders that can only send a limited number of
+// responses, like the Responder that Server uses for delayed responses. Splitter
+// and Progress use it to stay within the limit.
+type Budgeted interface {
+	// Remaining returns the number of responses that can still be sent,
+	// or -1 if it isn't known.
+	Remaining() int
+}
+
+// Update sends the Response to the user, replacing the message that was
+// previously sent, instead of sending a new one.
+func Update(r Responder, resp Response) error {
+	resp.ReplaceOriginal = true
+	return r.Respond(resp)
+}
+
+// Delete deletes the message that was previously sent to the user.
+func Delete(r Responder) error {
+	return r.Respond(Response{DeleteOriginal: true})
+}
+
 // Handler represents something that handles a slash command.
 type Handler interface {
 	// ServeCommand runs the command. The provided Responder object can be
@@ -43,6 +85,26 @@ func (fn HandlerFunc) ServeCommand(ctx context.Context, r Responder, command Com
 	return fn(ctx, r, command)
 }
 
+// Dispatcher is implemented by Handlers that can resolve the Handler that will
+// serve a Command, without serving it. Server dispatches commands
+// synchronously, so that routing and authorization failures can be returned as
+// an http error, and only the resolved Handler is served in the background.
+type Dispatcher interface {
+	// Dispatch returns the Handler that should serve the command, and the
+	// context.Context that it should be served with. If the command
+	// should be rejected, an error is returned.
+	Dispatch(context.Context, Command) (context.Context, Handler, error)
+}
+
+// Dispatch resolves the Handler that will serve the command. If h is a
+// Dispatcher, it's used to resolve the Handler, otherwise h is returned.
+func Dispatch(ctx context.Context, h Handler, command Command) (context.Context, Handler, error) {
+	if d, ok := h.(Dispatcher); ok {
+		return d.Dispatch(ctx, command)
+	}
+	return ctx, h, nil
+}
+
 // Matcher is something that can check if a Command matches a Route.
 type Matcher interface {
 	Match(Command) (map[string]string, bool)
@@ -57,16 +119,50 @@ func (fn MatcherFunc) Match(command Command) (map[string]string, bool) {
 
 // MatchCommand returns a Matcher that checks that the command strings match.
 func MatchCommand(cmd string) Matcher {
+	return commandMatcher(cmd)
+}
+
+// commandMatcher is the Matcher returned by MatchCommand. It's a distinct type
+// so that the Suggest handler can find the commands that a Mux handles.
+type commandMatcher string
+
+func (m commandMatcher) Match(command Command) (map[string]string, bool) {
+	return make(map[string]string), command.Command == string(m)
+}
+
+// MatchSubcommand returns a Matcher that checks that the first argument in the
+// text portion of a command is exactly subcmd. The text after the subcommand is
+// available as the "rest" param.
+func MatchSubcommand(subcmd string) Matcher {
+	return matchSubcommand(func(s string) bool { return s == subcmd })
+}
+
+// MatchSubcommandFold is like MatchSubcommand, but the subcommand is matched
+// case-insensitively.
+func MatchSubcommandFold(subcmd string) Matcher {
+	return matchSubcommand(func(s string) bool { return strings.EqualFold(s, subcmd) })
+}
+
+func matchSubcommand(match func(string) bool) Matcher {
 	return MatcherFunc(func(command Command) (map[string]string, bool) {
-		return make(map[string]string), command.Command == cmd
+		params := make(map[string]string)
+		subcmd, rest, ok := shift(command.Text)
+		if !ok || !match(subcmd) {
+			return params, false
+		}
+		params["rest"] = rest
+		return params, true
 	})
 }
 
-// MatchSubcommand returns a Matcher that checks for the first string of the
-// text portion of a command, assuming it's a subcommand.
-func MatchSubcommand(subcmd string) Matcher {
-	re := regexp.MustCompile(fmt.Sprintf("^%s.*$", subcmd))
-	return MatchTextRegexp(re)
+// shift splits the first argument off of the text, returning it and the rest
+// of the text. If the text is empty, false is returned.
+func shift(text string) (string, string, bool) {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return "", "", false
+	}
+	return tokens[0].value, strings.TrimSpace(text[tokens[0].end:]), true
 }
 
 // MatchTextRegexp returns a Matcher that checks that the command text matches a
@@ -94,6 +190,14 @@ func MatchTextRegexp(r *regexp.Regexp) Matcher {
 type Route struct {
 	Handler
 	Matcher
+
+	// Description, Usage and Examples are shown by the Mux help handler.
+	// Usage and Examples are relative to the Mux that the Route was added
+	// to, like "deploy {repo} [to {env}]". If Usage is empty, it defaults
+	// to the pattern for Pattern routes, or the subcommand for Mount routes.
+	Description string
+	Usage       string
+	Examples    []string
 }
 
 // NewRoute returns a new Route instance.
@@ -103,8 +207,22 @@ func NewRoute(handler Handler) *Route {
 	}
 }
 
+// Describe sets the Description, Usage and Examples of the Route.
+func (r *Route) Describe(description, usage string, examples ...string) *Route {
+	r.Description = description
+	r.Usage = usage
+	r.Examples = examples
+	return r
+}
+
 // Mux is a Handler implementation that routes commands to Handlers.
 type Mux struct {
+	// NotFound is served when no route matches the command. The zero value
+	// means the Handler returned by Suggest, which replies with similar
+	// subcommands. To reject the command with ErrNoHandler instead, use
+	// NoHandler.
+	NotFound Handler
+
 	routes []*Route
 }
 
@@ -129,6 +247,34 @@ func (m *Mux) MatchText(re *regexp.Regexp, handler Handler) *Route {
 	return m.Match(MatchTextRegexp(re), handler)
 }
 
+// Pattern adds a route that matches when the text of the command matches the
+// given pattern, like "deploy {repo} to {env}". If the route matches and is
+// called, slash.Params will return the placeholders. See Pattern for the
+// syntax.
+func (m *Mux) Pattern(pattern string, handler Handler) *Route {
+	return m.Match(MatchPattern(pattern), handler)
+}
+
+// Mount adds a route that matches when the first argument in the text of the
+// command is subcommand. The subcommand is removed from the text of the
+// command before it's passed to the handler, and added to slash.Path. This can
+// be used to build trees of commands, by mounting other Muxes.
+//
+// Example
+//
+//	db := slash.NewMux()
+//	db.Pattern("migrate {app}", MigrateHandler)
+//
+//	ops := slash.NewMux()
+//	ops.Mount("db", db)
+//	ops.Mount("deploy", DeployHandler)
+func (m *Mux) Mount(subcommand string, handler Handler) *Route {
+	return m.Match(MatchSubcommand(subcommand), &mount{
+		subcommand: subcommand,
+		handler:    handler,
+	})
+}
+
 // Match adds a new route that uses the given Matcher to match.
 func (m *Mux) Match(matcher Matcher, handler Handler) *Route {
 	r := NewRoute(handler)
@@ -153,77 +299,396 @@ func (m *Mux) Handler(command Command) (Handler, map[string]string) {
 }
 
 // ServeCommand attempts to find a Handler to serve the Command. If no handler
-// is found, an error is returned.
+// is found, NotFound is served.
 func (m *Mux) ServeCommand(ctx context.Context, r Responder, command Command) error {
+	ctx, h, err := m.Dispatch(ctx, command)
+	if err != nil {
+		return err
+	}
+	return h.ServeCommand(ctx, r, command)
+}
+
+// Dispatch finds the Handler to serve the Command, and dispatches to it. If no
+// handler is found, it dispatches to NotFound.
+func (m *Mux) Dispatch(ctx context.Context, command Command) (context.Context, Handler, error) {
 	h, params := m.Handler(command)
 	if h == nil {
-		return ErrNoHandler
+		notFound := m.NotFound
+		if notFound == nil {
+			notFound = m.Suggest()
+		}
+		return Dispatch(ctx, notFound, command)
+	}
+	return Dispatch(WithParams(ctx, params), h, command)
+}
+
+// mount is a Handler that removes the subcommand from the text of the command
+// before dispatching to the mounted Handler.
+type mount struct {
+	subcommand string
+	handler    Handler
+}
+
+func (m *mount) ServeCommand(ctx context.Context, r Responder, command Command) error {
+	ctx, h, err := m.Dispatch(ctx, command)
+	if err != nil {
+		return err
+	}
+	return h.ServeCommand(ctx, r, command)
+}
+
+func (m *mount) Dispatch(ctx context.Context, command Command) (context.Context, Handler, error) {
+	_, command.Text, _ = shift(command.Text)
+
+	path := append(append([]string(nil), Path(ctx)...), m.subcommand)
+	ctx, h, err := Dispatch(WithPath(ctx, path), m.handler, command)
+	if err != nil {
+		return ctx, nil, err
 	}
-	return h.ServeCommand(WithParams(ctx, params), r, command)
+	return ctx, &commandHandler{handler: h, command: command}, nil
+}
+
+// commandHandler is a Handler that serves a rewritten Command, in place of the
+// one it's called with.
+type commandHandler struct {
+	handler Handler
+	command Command
+}
+
+func (h *commandHandler) ServeCommand(ctx context.Context, r Responder, _ Command) error {
+	return h.handler.ServeCommand(ctx, r, h.command)
+}
+
+// NoHandler is a Handler that rejects every command with ErrNoHandler. When
+// it's the NotFound Handler of a Mux served by Server, commands that aren't
+// routed get an http 404.
+var NoHandler Handler = noHandler{}
+
+type noHandler struct{}
+
+func (noHandler) ServeCommand(ctx context.Context, r Responder, command Command) error {
+	return ErrNoHandler
+}
+
+func (noHandler) Dispatch(ctx context.Context, command Command) (context.Context, Handler, error) {
+	return ctx, nil, ErrNoHandler
 }
 
 // ValidateToken returns a new Handler that verifies that the token in the
 // request matches the given token.
 func ValidateToken(h Handler, token string) Handler {
-	return HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
-		// If an empty string was provided, this was probably a
-		// configuration error, so return unauthorized for safety.
-		if token == "" {
-			return ErrInvalidToken
-		}
+	return &tokenValidator{
+		handler: h,
+		token:   token,
+	}
+}
 
-		if command.Token != token {
-			return ErrInvalidToken
-		}
-		return h.ServeCommand(ctx, r, command)
-	})
+// tokenValidator is a Handler and Dispatcher that validates the token of the
+// command.
+type tokenValidator struct {
+	handler Handler
+	token   string
+}
+
+func (v *tokenValidator) ServeCommand(ctx context.Context, r Responder, command Command) error {
+	if err := v.validate(command); err != nil {
+		return err
+	}
+	return v.handler.ServeCommand(ctx, r, command)
+}
+
+func (v *tokenValidator) Dispatch(ctx context.Context, command Command) (context.Context, Handler, error) {
+	if err := v.validate(command); err != nil {
+		return ctx, nil, err
+	}
+	return Dispatch(ctx, v.handler, command)
+}
+
+func (v *tokenValidator) validate(command Command) error {
+	// If an empty string was provided, this was probably a configuration
+	// error, so return unauthorized for safety.
+	if v.token == "" {
+		return ErrInvalidToken
+	}
+
+	if command.Token != v.token {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// RetryPolicy configures how delayed responses are retried when posting them to
+// the response_url fails with a network error, a 5xx status, or a 429 status.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times that a response is
+	// retried.
+	MaxRetries int
+
+	// MinBackoff is how long to wait before the first retry. It's doubled
+	// after each retry, up to MaxBackoff. If a 429 response includes a
+	// Retry-After header, that's used instead.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used when none is provided.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MinBackoff: 500 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+}
+
+// backoff returns how long to wait before the given retry, starting at 0.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.MinBackoff
+	for i := 0; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
 }
 
 // responder is an implementation of the Responder interface that POST's the
-// response to the given url.
+// response to the given url. It enforces the limits that Slack places on the
+// response_url, so that handlers get an error before making the request.
 type responder struct {
 	responseURL *url.URL
 	client      *http.Client
+	retry       RetryPolicy
+
+	// Cancels in progress requests and retries. Requests are also
+	// cancelled once the response_url expires.
+	ctx context.Context
+
+	// The time that the command was received.
+	received time.Time
+
+	// The schemes and hosts that the response_url must match.
+	allowed []string
+
+	mu sync.Mutex
+	// The number of responses that have been sent.
+	sent int
 }
 
-func newResponder(command Command) *responder {
+// NewResponder returns a Responder that posts responses to the response_url of
+// the command, using the given http.Client and DefaultRetryPolicy. Like the
+// Responder used by Server, it returns ErrTooManyResponses and
+// ErrResponseURLExpired before making requests that Slack would reject, and
+// refuses to post to a response_url that doesn't match one of the allowed
+// schemes and hosts. If client is nil, http.DefaultClient is used, and if
+// allowed is nil, DefaultAllowedResponseURLs is used.
+func NewResponder(ctx context.Context, command Command, client *http.Client, allowed []string) Responder {
+	r := newResponder(ctx, command, allowed)
+	if client != nil {
+		r.client = client
+	}
+	return r
+}
+
+func newResponder(ctx context.Context, command Command, allowed []string) *responder {
+	if allowed == nil {
+		allowed = DefaultAllowedResponseURLs
+	}
+	// The response_url expires relative to when Slack sent the command,
+	// not when the responder was created.
+	received := ReceivedAt(ctx)
+	if received.IsZero() {
+		received = time.Now()
+	}
 	return &responder{
 		responseURL: command.ResponseURL,
 		client:      http.DefaultClient,
+		retry:       DefaultRetryPolicy,
+		ctx:         ctx,
+		received:    received,
+		allowed:     allowed,
 	}
 }
 
 func (r *responder) Respond(resp Response) error {
+	if err := ValidateResponseURL(r.responseURL, r.allowed); err != nil {
+		return err
+	}
+
+	if err := r.reserve(); err != nil {
+		return err
+	}
+
 	raw, err := json.Marshal(newResponse(resp))
 	if err != nil {
 		return err
 	}
 
+	ctx, cancel := context.WithDeadline(r.ctx, r.received.Add(ResponseURLLifetime))
+	defer cancel()
+
+	for retry := 0; ; retry++ {
+		err := r.post(ctx, raw)
+		if err == nil {
+			return nil
+		}
+
+		terr, ok := err.(*temporaryError)
+		if !ok {
+			return err
+		}
+
+		if retry >= r.retry.MaxRetries {
+			return terr.err
+		}
+
+		wait := terr.retryAfter
+		if wait < 0 {
+			wait = r.retry.backoff(retry)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// post makes a single attempt at posting the response. If the attempt can be
+// retried, a *temporaryError is returned.
+func (r *responder) post(ctx context.Context, raw []byte) error {
 	req, err := http.NewRequest("POST", r.responseURL.String(), bytes.NewReader(raw))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	hresp, err := r.client.Do(req)
+	hresp, err := ctxhttp.Do(ctx, r.client, req)
 	if err != nil {
-		return err
+		if ctx.Err() != nil {
+			return err
+		}
+		return &temporaryError{err: err, retryAfter: -1}
 	}
+	defer hresp.Body.Close()
 
 	if hresp.StatusCode/100 != 2 {
 		raw, _ := ioutil.ReadAll(hresp.Body)
-		return fmt.Errorf("error sending delayed response: %s", raw)
+		err := fmt.Errorf("error sending delayed response: %s", raw)
+
+		switch {
+		case hresp.StatusCode == http.StatusTooManyRequests:
+			return &temporaryError{err: err, retryAfter: retryAfter(hresp.Header.Get("Retry-After"))}
+		case hresp.StatusCode/100 == 5:
+			return &temporaryError{err: err, retryAfter: -1}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// temporaryError wraps an error from posting a response that can be retried.
+type temporaryError struct {
+	err error
+
+	// How long the server asked us to wait before retrying, or -1 if it
+	// didn't say.
+	retryAfter time.Duration
+}
+
+func (e *temporaryError) Error() string {
+	return e.err.Error()
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an http date. -1 is returned if it can't be parsed.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return -1
 	}
 
-	return err
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(time.Now()); d > 0 {
+			return d
+		}
+		return 0
+	}
+
+	return -1
+}
+
+// Remaining implements the Budgeted interface.
+func (r *responder) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.received) > ResponseURLLifetime {
+		return 0
+	}
+	return MaximumDelayedResponses - r.sent
+}
+
+// remaining returns the number of responses that r can still send, or -1 if
+// it isn't known.
+func remaining(r Responder) int {
+	if b, ok := r.(Budgeted); ok {
+		return b.Remaining()
+	}
+	return -1
+}
+
+// reserve checks that another response can be sent to the response_url, and
+// counts it against MaximumDelayedResponses.
+func (r *responder) reserve() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.received) > ResponseURLLifetime {
+		return ErrResponseURLExpired
+	}
+
+	if r.sent >= MaximumDelayedResponses {
+		return ErrTooManyResponses
+	}
+
+	r.sent++
+	return nil
 }
 
 type response struct {
-	ResponseType *string `json:"response_type,omitempty"`
-	Text         string  `json:"text"`
+	ResponseType *string      `json:"response_type,omitempty"`
+	Text         string       `json:"text"`
+	Blocks       []Block      `json:"blocks,omitempty"`
+	Attachments  []Attachment `json:"attachments,omitempty"`
+
+	ReplaceOriginal bool `json:"replace_original,omitempty"`
+	DeleteOriginal  bool `json:"delete_original,omitempty"`
+
+	ThreadTS    string `json:"thread_ts,omitempty"`
+	Mrkdwn      *bool  `json:"mrkdwn,omitempty"`
+	UnfurlLinks *bool  `json:"unfurl_links,omitempty"`
+	UnfurlMedia *bool  `json:"unfurl_media,omitempty"`
 }
 
 func newResponse(resp Response) *response {
-	r := &response{Text: resp.Text}
+	r := &response{
+		Text:        resp.Text,
+		Blocks:      resp.Blocks,
+		Attachments: resp.Attachments,
+
+		ReplaceOriginal: resp.ReplaceOriginal,
+		DeleteOriginal:  resp.DeleteOriginal,
+
+		ThreadTS:    resp.ThreadTS,
+		Mrkdwn:      resp.Mrkdwn,
+		UnfurlLinks: resp.UnfurlLinks,
+		UnfurlMedia: resp.UnfurlMedia,
+	}
 	if resp.InChannel {
 		t := "in_channel"
 		r.ResponseType = &t
@@ -1,6 +1,8 @@
 package slash
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -8,6 +10,7 @@ import (
 	"net/url"
 	"regexp"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -46,9 +49,144 @@ func TestMux_Command_NotFound(t *testing.T) {
 		Command: "/deploy",
 	}
 
+	r.On("Respond", Reply("Sorry, I don't know how to handle `/deploy`.")).Return(nil)
+
+	ctx := context.Background()
+	err := m.ServeCommand(ctx, r, cmd)
+	assert.NoError(t, err)
+
+	r.AssertExpectations(t)
+}
+
+func TestMux_Command_NoHandler(t *testing.T) {
+	r := new(mockResponder)
+	m := NewMux()
+	m.NotFound = NoHandler
+
+	cmd := Command{
+		Command: "/deploy",
+	}
+
 	ctx := context.Background()
 	err := m.ServeCommand(ctx, r, cmd)
-	assert.Equal(t, err, ErrNoHandler)
+	assert.Equal(t, ErrNoHandler, err)
+
+	_, _, err = m.Dispatch(ctx, cmd)
+	assert.Equal(t, ErrNoHandler, err)
+}
+
+func TestMux_Dispatch(t *testing.T) {
+	h := new(mockHandler)
+	m := NewMux()
+	m.Command("/deploy", "token", h)
+
+	ctx := context.Background()
+	dctx, dh, err := m.Dispatch(ctx, Command{Token: "token", Command: "/deploy"})
+	assert.NoError(t, err)
+	assert.Equal(t, h, dh)
+	assert.Equal(t, WithParams(ctx, make(map[string]string)), dctx)
+
+	_, _, err = m.Dispatch(ctx, Command{Token: "bad", Command: "/deploy"})
+	assert.Equal(t, ErrInvalidToken, err)
+
+	_, dh, err = m.Dispatch(ctx, Command{Token: "token", Command: "/weather"})
+	assert.NoError(t, err)
+	assert.Equal(t, m.Suggest(), dh)
+}
+
+func TestMux_Dispatch_Nested(t *testing.T) {
+	h := new(mockHandler)
+	sub := NewMux()
+	sub.MatchText(regexp.MustCompile(`^deploy (?P<repo>\S+)$`), h)
+	m := NewMux()
+	m.Command("/ops", "token", sub)
+
+	ctx := context.Background()
+	dctx, dh, err := m.Dispatch(ctx, Command{Token: "token", Command: "/ops", Text: "deploy acme-inc"})
+	assert.NoError(t, err)
+	assert.Equal(t, h, dh)
+	assert.Equal(t, map[string]string{"repo": "acme-inc"}, Params(dctx))
+
+	_, dh, err = m.Dispatch(ctx, Command{Token: "token", Command: "/ops", Text: "restart"})
+	assert.NoError(t, err)
+	assert.Equal(t, sub.Suggest(), dh)
+}
+
+func TestMux_Mount(t *testing.T) {
+	r := new(mockResponder)
+	h := new(mockHandler)
+
+	db := NewMux()
+	db.Pattern("migrate {app}", h)
+	ops := NewMux()
+	ops.Mount("db", db)
+	m := NewMux()
+	m.Command("/ops", "token", ops)
+
+	cmd := Command{Token: "token", Command: "/ops", Text: "db migrate acme-inc"}
+
+	ctx := context.Background()
+
+	expected := WithParams(ctx, make(map[string]string))
+	expected = WithParams(expected, map[string]string{"rest": "migrate acme-inc"})
+	expected = WithPath(expected, []string{"db"})
+	expected = WithParams(expected, map[string]string{"app": "acme-inc"})
+
+	h.On("ServeCommand",
+		expected,
+		r,
+		Command{Token: "token", Command: "/ops", Text: "migrate acme-inc"},
+	).Return(Reply(""), nil)
+
+	err := m.ServeCommand(ctx, r, cmd)
+	assert.NoError(t, err)
+
+	h.AssertExpectations(t)
+}
+
+func TestMux_Mount_Dispatch(t *testing.T) {
+	var served Command
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		served = command
+		return nil
+	})
+
+	migrate := NewMux()
+	migrate.Match(MatchSubcommand("run"), h)
+	db := NewMux()
+	db.Mount("migrate", migrate)
+	m := NewMux()
+	m.Mount("db", db)
+
+	ctx := context.Background()
+	dctx, dh, err := m.Dispatch(ctx, Command{Text: `db migrate run "acme inc"`})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db", "migrate"}, Path(dctx))
+	assert.Equal(t, map[string]string{"rest": `"acme inc"`}, Params(dctx))
+
+	// The resolved Handler serves the rewritten command, regardless of the
+	// command that it's called with.
+	err = dh.ServeCommand(dctx, new(mockResponder), Command{Text: `db migrate run "acme inc"`})
+	assert.NoError(t, err)
+	assert.Equal(t, Command{Text: `run "acme inc"`}, served)
+
+	_, dh, err = m.Dispatch(ctx, Command{Text: "db restart"})
+	assert.NoError(t, err)
+	assert.Equal(t, db.Suggest(), dh.(*commandHandler).handler)
+
+	_, dh, err = m.Dispatch(ctx, Command{Text: "dbmigrate run"})
+	assert.NoError(t, err)
+	assert.Equal(t, m.Suggest(), dh)
+}
+
+func TestDispatch_Handler(t *testing.T) {
+	h := new(mockHandler)
+	ctx := context.Background()
+
+	dctx, dh, err := Dispatch(ctx, h, Command{})
+	assert.NoError(t, err)
+	assert.Equal(t, h, dh)
+	assert.Equal(t, ctx, dctx)
 }
 
 func TestMux_MatchText_Found(t *testing.T) {
@@ -132,6 +270,72 @@ func TestMatchSubcommand(t *testing.T) {
 
 	_, ok = m.Match(Command{Text: "help with something"})
 	assert.True(t, ok)
+
+	_, ok = m.Match(Command{Text: "helpme"})
+	assert.False(t, ok)
+
+	_, ok = m.Match(Command{Text: "Help"})
+	assert.False(t, ok)
+}
+
+func TestMatchSubcommand_Rest(t *testing.T) {
+	m := MatchSubcommand("deploy")
+
+	params, ok := m.Match(Command{Text: "  deploy  acme-inc   to staging "})
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"rest": "acme-inc   to staging"}, params)
+
+	params, ok = m.Match(Command{Text: "deploy"})
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"rest": ""}, params)
+
+	params, ok = m.Match(Command{Text: `"deploy" "acme inc"`})
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"rest": `"acme inc"`}, params)
+}
+
+func TestMatchSubcommand_Metacharacters(t *testing.T) {
+	m := MatchSubcommand("c++")
+
+	_, ok := m.Match(Command{Text: "c++ build"})
+	assert.True(t, ok)
+
+	_, ok = m.Match(Command{Text: "cc build"})
+	assert.False(t, ok)
+
+	m = MatchSubcommand("(")
+
+	_, ok = m.Match(Command{Text: "( foo"})
+	assert.True(t, ok)
+}
+
+func TestMatchSubcommandFold(t *testing.T) {
+	m := MatchSubcommandFold("help")
+
+	params, ok := m.Match(Command{Text: "HELP deploy"})
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"rest": "deploy"}, params)
+
+	_, ok = m.Match(Command{Text: "Helpme"})
+	assert.False(t, ok)
+}
+
+func TestUpdate(t *testing.T) {
+	r := new(mockResponder)
+	r.On("Respond", Response{Text: "50%", ReplaceOriginal: true}).Return(nil)
+
+	err := Update(r, Reply("50%"))
+	assert.NoError(t, err)
+	r.AssertExpectations(t)
+}
+
+func TestDelete(t *testing.T) {
+	r := new(mockResponder)
+	r.On("Respond", Response{DeleteOriginal: true}).Return(nil)
+
+	err := Delete(r)
+	assert.NoError(t, err)
+	r.AssertExpectations(t)
 }
 
 func TestResponder(t *testing.T) {
@@ -145,16 +349,28 @@ func TestResponder(t *testing.T) {
 	defer s.Close()
 
 	u, _ := url.Parse(s.URL)
-	r := &responder{
-		responseURL: u,
-		client:      http.DefaultClient,
-	}
+	r := newResponder(context.Background(), Command{ResponseURL: u}, []string{s.URL})
 
 	err := r.Respond(Reply("ok"))
 	assert.NoError(t, err)
 	assert.True(t, called)
 }
 
+func TestResponder_InvalidResponseURL(t *testing.T) {
+	var called bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer s.Close()
+
+	r := NewResponder(context.Background(), Command{ResponseURL: mustURL(s.URL)}, nil, nil)
+
+	err := r.Respond(Reply("ok"))
+	var uerr *InvalidResponseURLError
+	assert.True(t, errors.As(err, &uerr))
+	assert.False(t, called)
+}
+
 func TestResponder_Err(t *testing.T) {
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(404)
@@ -163,11 +379,173 @@ func TestResponder_Err(t *testing.T) {
 	defer s.Close()
 
 	u, _ := url.Parse(s.URL)
-	r := &responder{
-		responseURL: u,
-		client:      http.DefaultClient,
-	}
+	r := newResponder(context.Background(), Command{ResponseURL: u}, []string{s.URL})
 
 	err := r.Respond(Reply("ok"))
 	assert.EqualError(t, err, "error sending delayed response: Used url")
 }
+
+func TestResponder_TooManyResponses(t *testing.T) {
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	r := newResponder(context.Background(), Command{ResponseURL: u}, []string{s.URL})
+
+	for i := 0; i < MaximumDelayedResponses; i++ {
+		err := r.Respond(Reply("ok"))
+		assert.NoError(t, err)
+	}
+
+	err := r.Respond(Reply("ok"))
+	assert.Equal(t, ErrTooManyResponses, err)
+	assert.Equal(t, MaximumDelayedResponses, calls)
+}
+
+func TestResponder_Expired(t *testing.T) {
+	requests := make(chan struct{}, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	r := newResponder(context.Background(), Command{ResponseURL: u}, []string{s.URL})
+	r.received = time.Now().Add(-ResponseURLLifetime - time.Second)
+
+	err := r.Respond(Reply("ok"))
+	assert.Equal(t, ErrResponseURLExpired, err)
+	assert.Len(t, requests, 0, "request should not be made")
+}
+
+func TestResponder_ReceivedAt(t *testing.T) {
+	requests := make(chan struct{}, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	ctx := WithReceivedAt(context.Background(), time.Now().Add(-ResponseURLLifetime-time.Second))
+	r := newResponder(ctx, Command{ResponseURL: u}, []string{s.URL})
+
+	err := r.Respond(Reply("ok"))
+	assert.Equal(t, ErrResponseURLExpired, err)
+	assert.Len(t, requests, 0, "request should not be made")
+	assert.Equal(t, 0, r.Remaining())
+}
+
+func TestResponder_ReplaceOriginal(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"text":"ok","replace_original":true}`, string(raw))
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	r := newResponder(context.Background(), Command{ResponseURL: u}, []string{s.URL})
+
+	err := Update(r, Reply("ok"))
+	assert.NoError(t, err)
+}
+
+func TestNewResponse(t *testing.T) {
+	resp := Say("https://github.com/ejholmes/slash")
+	resp.ThreadTS = "1355517523.000005"
+	resp.Mrkdwn = Bool(false)
+	resp.UnfurlLinks = Bool(false)
+	resp.UnfurlMedia = Bool(true)
+
+	raw, err := json.Marshal(newResponse(resp))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"response_type": "in_channel",
+		"text": "https://github.com/ejholmes/slash",
+		"thread_ts": "1355517523.000005",
+		"mrkdwn": false,
+		"unfurl_links": false,
+		"unfurl_media": true
+	}`, string(raw))
+}
+
+func TestResponder_Retry(t *testing.T) {
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	r := newResponder(context.Background(), Command{ResponseURL: u}, []string{s.URL})
+	r.retry = RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	err := r.Respond(Reply("ok"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 1, r.sent)
+}
+
+func TestResponder_Retry_MaxRetries(t *testing.T) {
+	var calls int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, "boom")
+	}))
+	defer s.Close()
+
+	u, _ := url.Parse(s.URL)
+	r := newResponder(context.Background(), Command{ResponseURL: u}, []string{s.URL})
+	r.retry = RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	err := r.Respond(Reply("ok"))
+	assert.EqualError(t, err, "error sending delayed response: boom")
+	assert.Equal(t, 3, calls)
+}
+
+func TestResponder_Retry_Cancel(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	u, _ := url.Parse(s.URL)
+	r := newResponder(ctx, Command{ResponseURL: u}, []string{s.URL})
+	r.retry = RetryPolicy{MaxRetries: 2, MinBackoff: time.Hour, MaxBackoff: time.Hour}
+
+	err := r.Respond(Reply("ok"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, p.backoff(0))
+	assert.Equal(t, 2*time.Second, p.backoff(1))
+	assert.Equal(t, 4*time.Second, p.backoff(2))
+	assert.Equal(t, 5*time.Second, p.backoff(3))
+	assert.Equal(t, 5*time.Second, p.backoff(100))
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, time.Duration(-1), retryAfter(""))
+	assert.Equal(t, time.Duration(-1), retryAfter("soon"))
+	assert.Equal(t, 2*time.Second, retryAfter("2"))
+	assert.Equal(t, time.Duration(0), retryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+
+	d := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, d > 50*time.Second && d <= time.Minute, "got %v", d)
+}
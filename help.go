@@ -0,0 +1,145 @@
+package slash
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// The subcommand that the help handler is mounted at.
+const helpSubcommand = "help"
+
+// Help mounts a handler at the "help" subcommand that lists the routes in the
+// Mux, including the routes of any Muxes that are mounted within it. Routes are
+// listed with their Usage, Description and Examples. Routes without any of
+// those, like MatchText routes, are left out.
+//
+// The listing can be narrowed down to a subcommand, like "/ops help db".
+//
+// Example
+//
+//	ops := slash.NewMux()
+//	ops.Pattern("deploy {repo} [to {env}]", DeployHandler).
+//		Describe("Deploy a repo.", "", "deploy acme-inc to staging")
+//	ops.Help()
+func (m *Mux) Help() *Route {
+	return m.Mount(helpSubcommand, &helpHandler{mux: m}).
+		Describe("Show help for commands.", "help [command]")
+}
+
+// helpHandler is a Handler that renders the help for a Mux.
+type helpHandler struct {
+	mux *Mux
+}
+
+func (h *helpHandler) ServeCommand(ctx context.Context, r Responder, command Command) error {
+	// Remove the help subcommand itself from the path to get the prefix of
+	// the Mux that's being described.
+	prefix := []string{command.Command}
+	if path := Path(ctx); len(path) > 0 {
+		prefix = append(prefix, path[:len(path)-1]...)
+	}
+	cmd := strings.TrimSpace(strings.Join(prefix, " "))
+
+	var query []string
+	for _, tok := range tokenize(command.Text) {
+		query = append(query, tok.value)
+	}
+
+	var entries []helpEntry
+	for _, e := range h.mux.helpEntries(nil) {
+		if e.matches(query) {
+			entries = append(entries, e)
+		}
+	}
+
+	if len(entries) == 0 {
+		return r.Respond(Reply(fmt.Sprintf("Sorry, there's no help for `%s %s`.", cmd, strings.Join(query, " "))))
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		e.render(&b, cmd)
+	}
+	return r.Respond(Reply(strings.TrimRight(b.String(), "\n")))
+}
+
+// helpEntry is a Route, as shown by the help handler.
+type helpEntry struct {
+	// The usage, split into words, including the subcommands of any Muxes
+	// that it's mounted within.
+	usage []string
+
+	description string
+	examples    []string
+}
+
+// matches returns true if the usage starts with the words in the query.
+func (e helpEntry) matches(query []string) bool {
+	if len(query) > len(e.usage) {
+		return false
+	}
+	for i, q := range query {
+		if e.usage[i] != q {
+			return false
+		}
+	}
+	return true
+}
+
+func (e helpEntry) render(b *strings.Builder, cmd string) {
+	fmt.Fprintf(b, "`%s`", strings.Join(append([]string{cmd}, e.usage...), " "))
+	if e.description != "" {
+		fmt.Fprintf(b, " - %s", e.description)
+	}
+	b.WriteString("\n")
+	for _, example := range e.examples {
+		fmt.Fprintf(b, ">`%s %s`\n", cmd, example)
+	}
+}
+
+// helpEntries returns the help for the routes in the Mux, recursing into
+// mounted Muxes. The usage of every entry is prefixed with prefix.
+func (m *Mux) helpEntries(prefix []string) []helpEntry {
+	var entries []helpEntry
+
+	join := func(s string) []string {
+		return append(append([]string(nil), prefix...), strings.Fields(s)...)
+	}
+
+	for _, r := range m.routes {
+		mt, mounted := r.Handler.(*mount)
+
+		usage := r.Usage
+		if usage == "" {
+			switch {
+			case mounted:
+				usage = mt.subcommand
+			default:
+				if p, ok := r.Matcher.(*Pattern); ok {
+					usage = p.String()
+				}
+			}
+		}
+
+		if r.Description != "" || r.Usage != "" || (!mounted && usage != "") {
+			e := helpEntry{
+				usage:       join(usage),
+				description: r.Description,
+			}
+			for _, example := range r.Examples {
+				e.examples = append(e.examples, strings.Join(join(example), " "))
+			}
+			entries = append(entries, e)
+		}
+
+		if mounted {
+			if sub, ok := mt.handler.(*Mux); ok {
+				entries = append(entries, sub.helpEntries(join(mt.subcommand))...)
+			}
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,89 @@
+package slash
+
+import (
+	"regexp"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newHelpMux() *Mux {
+	h := new(mockHandler)
+
+	db := NewMux()
+	db.Pattern("migrate {app}", h).
+		Describe("Run migrations.", "", "migrate acme-inc")
+	db.Pattern("console {app}", h)
+
+	ops := NewMux()
+	ops.Pattern("deploy {repo} [to {env}]", h).
+		Describe("Deploy a repo.", "", "deploy acme-inc", "deploy acme-inc to staging")
+	ops.Mount("db", db).
+		Describe("Manage databases.", "db <command>")
+	ops.MatchText(regexp.MustCompile(`^secret$`), h)
+	ops.Help()
+
+	m := NewMux()
+	m.Command("/ops", "token", ops)
+	return m
+}
+
+func TestMux_Help(t *testing.T) {
+	r := new(mockResponder)
+	m := newHelpMux()
+
+	r.On("Respond", Reply("`/ops deploy {repo} [to {env}]` - Deploy a repo.\n"+
+		">`/ops deploy acme-inc`\n"+
+		">`/ops deploy acme-inc to staging`\n"+
+		"`/ops db <command>` - Manage databases.\n"+
+		"`/ops db migrate {app}` - Run migrations.\n"+
+		">`/ops db migrate acme-inc`\n"+
+		"`/ops db console {app}`\n"+
+		"`/ops help [command]` - Show help for commands.")).Return(nil)
+
+	err := m.ServeCommand(context.Background(), r, Command{Token: "token", Command: "/ops", Text: "help"})
+	assert.NoError(t, err)
+
+	r.AssertExpectations(t)
+}
+
+func TestMux_Help_Subcommand(t *testing.T) {
+	r := new(mockResponder)
+	m := newHelpMux()
+
+	r.On("Respond", Reply("`/ops db <command>` - Manage databases.\n"+
+		"`/ops db migrate {app}` - Run migrations.\n"+
+		">`/ops db migrate acme-inc`\n"+
+		"`/ops db console {app}`")).Return(nil)
+	r.On("Respond", Reply("`/ops db migrate {app}` - Run migrations.\n"+
+		">`/ops db migrate acme-inc`")).Return(nil)
+	r.On("Respond", Reply("Sorry, there's no help for `/ops restart`.")).Return(nil)
+
+	ctx := context.Background()
+	for _, text := range []string{"help db", "help db migrate", "help restart"} {
+		err := m.ServeCommand(ctx, r, Command{Token: "token", Command: "/ops", Text: text})
+		assert.NoError(t, err)
+	}
+
+	r.AssertExpectations(t)
+}
+
+func TestMux_Help_Nested(t *testing.T) {
+	r := new(mockResponder)
+
+	db := NewMux()
+	db.Pattern("migrate {app}", new(mockHandler))
+	db.Help()
+	m := NewMux()
+	m.Mount("db", db)
+
+	r.On("Respond", Reply("`/ops db migrate {app}`\n"+
+		"`/ops db help [command]` - Show help for commands.")).Return(nil)
+
+	err := m.ServeCommand(context.Background(), r, Command{Command: "/ops", Text: "db help"})
+	assert.NoError(t, err)
+
+	r.AssertExpectations(t)
+}
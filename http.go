@@ -1,7 +1,13 @@
 package slash
 
 import (
+	"encoding/json"
+	"log"
+	"mime"
 	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -10,8 +16,128 @@ import (
 type Server struct {
 	Handler
 	Context func() context.Context
+
+	// RequestContext, if set, is called to derive the context.Context that
+	// the command is served with from the http request and the parsed
+	// Command. The provided context already contains the ReceivedAt time
+	// and RequestID.
+	RequestContext func(ctx context.Context, r *http.Request, command Command) context.Context
+
+	// CommandTimeout is the maximum amount of time that a command is
+	// allowed to run for, measured from when it was received. When it's
+	// exceeded, the context.Context of the command is cancelled. The zero
+	// value means no timeout.
+	CommandTimeout time.Duration
+
+	// SigningSecret is the signing secret for the Slack app. When set, the
+	// X-Slack-Signature header of incoming requests is verified before the
+	// Command is parsed.
+	SigningSecret string
+
+	// MaxClockSkew is the maximum allowed difference between the
+	// X-Slack-Request-Timestamp header and the local clock. The zero value
+	// means DefaultMaxClockSkew.
+	MaxClockSkew time.Duration
+
+	// AllowedResponseURLs are the schemes and hosts, like
+	// "https://hooks.slack.com", that the response_url of a command must
+	// match. Commands with any other response_url are rejected with an
+	// error wrapping an *InvalidResponseURLError. The zero value means
+	// DefaultAllowedResponseURLs.
+	AllowedResponseURLs []string
+
+	// ResponseTimeout is how long to wait for the first Response from the
+	// Handler before acknowledging the request with an empty body. A
+	// Response sent before the timeout is written directly to the http
+	// response, and subsequent responses are sent to the response_url. The
+	// zero value means DefaultResponseTimeout, which leaves some room before
+	// Slack's own ResponseTimeout to write the response.
+	ResponseTimeout time.Duration
+
+	// Client is the http.Client used to post delayed responses to the
+	// response_url. The zero value means http.DefaultClient.
+	Client *http.Client
+
+	// Retry configures how delayed responses are retried when posting them
+	// to the response_url fails. The zero value means DefaultRetryPolicy.
+	Retry *RetryPolicy
+
+	// NewResponder, if set, is called to create the Responder used to send
+	// delayed responses for a command, instead of the default Responder
+	// configured with Client and Retry. Unlike the context.Context that the
+	// command is served with, the context.Context isn't cancelled when the
+	// command finishes or times out, or when Shutdown times out, so that
+	// errors can still be reported to the user.
+	NewResponder func(context.Context, Command) Responder
+
+	// ErrorHandler is called when the Handler returns an error. It can be
+	// used to log the error, or customize the message that's sent back to
+	// the user. The zero value means DefaultErrorHandler.
+	ErrorHandler func(context.Context, Responder, Command, error)
+
+	// RenderError is called to render errors that occur before the
+	// command is dispatched, like an invalid signature. The zero value
+	// means DefaultRenderError.
+	RenderError func(http.ResponseWriter, *http.Request, error)
+
+	// PanicHandler is called with the recovered value and stack trace when
+	// the Handler panics. The zero value logs the panic with the log
+	// package. In either case, a generic failure message is sent to the
+	// user.
+	PanicHandler func(ctx context.Context, command Command, v interface{}, stack []byte)
+
+	// Unavailable is the Handler used to serve commands that are received
+	// after Shutdown has been called. The zero value replies with a
+	// message asking the user to try again.
+	Unavailable Handler
+
+	// MaxConcurrency limits the number of commands that are served
+	// concurrently. Once the limit is reached, up to QueueSize commands
+	// will wait for a slot. The zero value means no limit.
+	MaxConcurrency int
+
+	// MaxConcurrencyPerCommand is like MaxConcurrency, but limits the
+	// number of concurrent commands with the same Command name, so that
+	// one noisy command can't starve the others. The zero value means no
+	// limit.
+	MaxConcurrencyPerCommand int
+
+	// QueueSize is the number of commands that can wait for a slot once
+	// MaxConcurrency or MaxConcurrencyPerCommand is reached.
+	QueueSize int
+
+	// Busy is the Handler used to serve commands that are received when
+	// the queue is full. The zero value replies with a message asking the
+	// user to try again.
+	Busy Handler
+
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	inShutdown bool
+	// cancel funcs for the contexts of in flight commands.
+	active map[*context.CancelFunc]struct{}
+
+	limiter *limiter
+	// limiters for each command name, which are removed once no commands
+	// are using them, so that unknown command names can't grow the map
+	// without bound.
+	commandLimiters map[string]*commandLimiter
 }
 
+// DefaultResponseTimeout is the default amount of time that the Server waits
+// for the first Response. It's shorter than ResponseTimeout, so that the request
+// is acknowledged before Slack gives up on it.
+const DefaultResponseTimeout = ResponseTimeout - 500*time.Millisecond
+
+// The message sent to the user when a Handler panics.
+const panicMessage = "Oops! Something went wrong."
+
+// The message sent to the user when the Server is shutting down.
+const unavailableMessage = "I'm restarting right now, please try again in a moment."
+
+// The message sent to the user when the queue is full.
+const busyMessage = "I'm busy right now, please try again in a moment."
+
 // NewServer returns a new Server instance.
 func NewServer(h Handler) *Server {
 	return &Server{
@@ -28,7 +154,11 @@ func (h *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.ServeHTTPContext(ctx(), w, r); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		renderError := h.RenderError
+		if renderError == nil {
+			renderError = DefaultRenderError
+		}
+		renderError(w, r, err)
 		return
 	}
 
@@ -37,12 +167,316 @@ func (h *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // ServeHTTPContext serves the http request with context.Context support.
 func (h *Server) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	command, err := ParseRequest(r)
+	received := time.Now()
+
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		return ErrMethodNotAllowed
+	}
+
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/x-www-form-urlencoded" {
+		return ErrUnsupportedMediaType
+	}
+
+	if h.SigningSecret != "" {
+		maxSkew := h.MaxClockSkew
+		if maxSkew == 0 {
+			maxSkew = DefaultMaxClockSkew
+		}
+
+		if err := VerifyRequest(r, h.SigningSecret, maxSkew); err != nil {
+			return err
+		}
+	}
+
+	command, err := ParseAndValidateRequest(r, h.AllowedResponseURLs)
 	if err != nil {
 		return err
 	}
 
-	go h.ServeCommand(ctx, newResponder(command), command)
+	ctx = WithRequestID(WithReceivedAt(ctx, received), newRequestID())
+	if h.RequestContext != nil {
+		ctx = h.RequestContext(ctx, r, command)
+	}
+
+	// Routing and authorization happen synchronously, so that rejected
+	// commands get an http error.
+	ctx, handler, err := Dispatch(ctx, h.Handler, command)
+	if err != nil {
+		return err
+	}
+
+	// Delayed responses outlive the command, so that errors caused by
+	// CommandTimeout or Shutdown can still be sent.
+	rctx := ctx
+
+	release := func() {}
+	ctx, finish, ok := h.track(ctx)
+	if !ok {
+		handler = h.Unavailable
+		if handler == nil {
+			handler = HandlerFunc(unavailable)
+		}
+	} else if ls, r := h.limiters(command); ls.reserve() {
+		handler = ls.limit(handler)
+		release = r
+	} else {
+		r()
+		handler = h.Busy
+		if handler == nil {
+			handler = HandlerFunc(busy)
+		}
+	}
+
+	cancel := func() {}
+	if h.CommandTimeout != 0 {
+		ctx, cancel = context.WithDeadline(ctx, received.Add(h.CommandTimeout))
+	}
+
+	resp := newImmediateResponder(h.newResponder(rctx, command))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer finish()
+		defer release()
+		defer cancel()
+		h.serveCommand(ctx, handler, resp, command)
+	}()
+
+	timeout := h.ResponseTimeout
+	if timeout == 0 {
+		timeout = DefaultResponseTimeout
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-resp.ready:
+	case <-done:
+	case <-t.C:
+	}
+
+	if r := resp.close(); r != nil {
+		// Encode before writing any headers, so that errors can still be
+		// rendered.
+		raw, err := json.Marshal(newResponse(*r))
+		if err != nil {
+			return err
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(append(raw, '\n'))
+		return err
+	}
+
+	return nil
+}
+
+// Shutdown gracefully shuts down the Server. Commands received after Shutdown
+// is called are served by the Unavailable handler, and Shutdown waits for any
+// in flight commands to finish. If ctx expires before they finish, their
+// contexts are cancelled and ctx's error is returned.
+func (h *Server) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.inShutdown = true
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		h.mu.Lock()
+		for cancel := range h.active {
+			(*cancel)()
+		}
+		h.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// track registers a new in flight command, returning a context that will be
+// cancelled if Shutdown times out, and a function that must be called when the
+// command finishes. If the Server is shutting down, false is returned.
+func (h *Server) track(ctx context.Context) (context.Context, func(), bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.inShutdown {
+		return ctx, func() {}, false
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	key := &cancel
+	if h.active == nil {
+		h.active = make(map[*context.CancelFunc]struct{})
+	}
+	h.active[key] = struct{}{}
+	h.wg.Add(1)
+
+	return ctx, func() {
+		h.mu.Lock()
+		delete(h.active, key)
+		h.mu.Unlock()
+		cancel()
+		h.wg.Done()
+	}, true
+}
+
+// newResponder returns the Responder used to send delayed responses.
+func (h *Server) newResponder(ctx context.Context, command Command) Responder {
+	if h.NewResponder != nil {
+		return h.NewResponder(ctx, command)
+	}
+
+	r := newResponder(ctx, command, h.AllowedResponseURLs)
+	if h.Client != nil {
+		r.client = h.Client
+	}
+	if h.Retry != nil {
+		r.retry = *h.Retry
+	}
+	return r
+}
+
+// limiters returns the limiters that apply to the command, and a function that
+// must be called once the command is no longer using them.
+func (h *Server) limiters(command Command) (limiters, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var ls limiters
+	release := func() {}
+
+	if h.MaxConcurrencyPerCommand > 0 {
+		name := command.Command
+		l, ok := h.commandLimiters[name]
+		if !ok {
+			l = &commandLimiter{limiter: newLimiter(h.MaxConcurrencyPerCommand, h.QueueSize)}
+			if h.commandLimiters == nil {
+				h.commandLimiters = make(map[string]*commandLimiter)
+			}
+			h.commandLimiters[name] = l
+		}
+		l.refs++
+		ls = append(ls, l.limiter)
+
+		release = func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			l.refs--
+			if l.refs == 0 {
+				delete(h.commandLimiters, name)
+			}
+		}
+	}
+
+	if h.MaxConcurrency > 0 {
+		if h.limiter == nil {
+			h.limiter = newLimiter(h.MaxConcurrency, h.QueueSize)
+		}
+		ls = append(ls, h.limiter)
+	}
 
+	return ls, release
+}
+
+// serveCommand serves the Command using the given Handler, and reports any
+// returned error or panic back to the user.
+func (h *Server) serveCommand(ctx context.Context, handler Handler, r Responder, command Command) {
+	defer func() {
+		if v := recover(); v != nil {
+			panicHandler := h.PanicHandler
+			if panicHandler == nil {
+				panicHandler = logPanic
+			}
+			panicHandler(ctx, command, v, debug.Stack())
+			r.Respond(Reply(panicMessage))
+		}
+	}()
+
+	if err := handler.ServeCommand(ctx, r, command); err != nil {
+		errorHandler := h.ErrorHandler
+		if errorHandler == nil {
+			errorHandler = DefaultErrorHandler
+		}
+		errorHandler(ctx, r, command, err)
+	}
+}
+
+// DefaultErrorHandler replies to the user with the message from UserMessage as
+// an ephemeral message.
+func DefaultErrorHandler(ctx context.Context, r Responder, command Command, err error) {
+	r.Respond(Reply(UserMessage(err)))
+}
+
+// unavailable is the default Unavailable handler.
+func unavailable(ctx context.Context, r Responder, command Command) error {
+	return r.Respond(Reply(unavailableMessage))
+}
+
+// busy is the default Busy handler.
+func busy(ctx context.Context, r Responder, command Command) error {
+	return r.Respond(Reply(busyMessage))
+}
+
+// logPanic is the default PanicHandler.
+func logPanic(ctx context.Context, command Command, v interface{}, stack []byte) {
+	log.Printf("slash: panic serving %s: %v\n%s", command.Command, v, stack)
+}
+
+// immediateResponder is a Responder that holds on to the first Response so
+// that it can be written directly to the http response. Once closed, all
+// responses are sent with the delayed Responder.
+type immediateResponder struct {
+	delayed Responder
+
+	// ready is closed when the first Response is available.
+	ready chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	resp   *Response
+}
+
+func newImmediateResponder(delayed Responder) *immediateResponder {
+	return &immediateResponder{
+		delayed: delayed,
+		ready:   make(chan struct{}),
+	}
+}
+
+func (r *immediateResponder) Respond(resp Response) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return r.delayed.Respond(resp)
+	}
+	r.closed = true
+	r.resp = &resp
+	close(r.ready)
+	r.mu.Unlock()
 	return nil
 }
+
+// Remaining implements the Budgeted interface. The immediate response isn't
+// counted, since it may not be available by the time it's used.
+func (r *immediateResponder) Remaining() int {
+	return remaining(r.delayed)
+}
+
+// close stops accepting immediate responses and returns the Response that
+// should be written to the http response, if any.
+func (r *immediateResponder) close() *Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return r.resp
+}
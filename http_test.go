@@ -2,10 +2,15 @@ package slash
 
 import (
 	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -22,6 +27,7 @@ func TestServer_Reply(t *testing.T) {
 
 	resp := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	s.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusOK, resp.Code)
@@ -38,6 +44,7 @@ func TestServer_Say(t *testing.T) {
 
 	resp := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	s.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusOK, resp.Code)
@@ -54,7 +61,736 @@ func TestServer_Err(t *testing.T) {
 
 	resp := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	s.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `{"text":"boom"}`+"\n", resp.Body.String())
+}
+
+func TestServer_ErrorHandler(t *testing.T) {
+	boom := errors.New("boom")
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		return boom
+	})
+
+	var reported error
+	s := &Server{
+		Handler: h,
+		ErrorHandler: func(ctx context.Context, r Responder, command Command, err error) {
+			reported = err
+			r.Respond(Reply("Something went wrong"))
+		},
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `{"text":"Something went wrong"}`+"\n", resp.Body.String())
+	assert.Equal(t, boom, reported)
+}
+
+func TestServer_Panic(t *testing.T) {
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		panic("boom")
+	})
+
+	var (
+		recovered interface{}
+		stack     []byte
+	)
+	s := &Server{
+		Handler: h,
+		PanicHandler: func(ctx context.Context, command Command, v interface{}, s []byte) {
+			recovered, stack = v, s
+		},
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `{"text":"Oops! Something went wrong."}`+"\n", resp.Body.String())
+	assert.Equal(t, "boom", recovered)
+	assert.Contains(t, string(stack), "TestServer_Panic")
+}
+
+func TestServer_SigningSecret(t *testing.T) {
+	called := make(chan struct{}, 1)
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		called <- struct{}{}
+		return nil
+	})
+	s := &Server{
+		Handler:       h,
+		SigningSecret: "secret",
+	}
+
+	resp := httptest.NewRecorder()
+	req := newSignedRequest(testForm, "secret", time.Now().Unix())
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+}
+
+func TestServer_SigningSecret_Invalid(t *testing.T) {
+	called := make(chan struct{}, 1)
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		called <- struct{}{}
+		return nil
+	})
+	s := &Server{
+		Handler:       h,
+		SigningSecret: "secret",
+	}
+
+	resp := httptest.NewRecorder()
+	req := newSignedRequest(testForm, "other", time.Now().Unix())
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Unauthorized.\n", resp.Body.String())
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Len(t, called, 0, "handler should not be called")
+}
+
+func TestServer_ImmediateResponse(t *testing.T) {
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		return r.Respond(Say("ok"))
+	})
+	s := &Server{
+		Handler: h,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+	assert.Equal(t, `{"response_type":"in_channel","text":"ok"}`+"\n", resp.Body.String())
+}
+
+func TestServer_DelayedResponse(t *testing.T) {
+	delayed := make(chan string, 2)
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		delayed <- string(raw)
+	}))
+	defer rs.Close()
+
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		<-release
+		return r.Respond(Reply("ok"))
+	})
+	s := &Server{
+		Handler:             h,
+		ResponseTimeout:     10 * time.Millisecond,
+		AllowedResponseURLs: []string{rs.URL},
+	}
+
+	cmd := Command{ResponseURL: mustURL(rs.URL)}
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(ValuesFromCommand(cmd).Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "", resp.Body.String())
+
+	close(release)
+
+	select {
+	case raw := <-delayed:
+		assert.Equal(t, `{"text":"ok"}`, raw)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestServer_DefaultResponseTimeout(t *testing.T) {
+	// The request has to be acknowledged before Slack gives up on it. The
+	// timeout itself is covered by TestServer_DelayedResponse.
+	assert.True(t, DefaultResponseTimeout > 0)
+	assert.True(t, DefaultResponseTimeout < ResponseTimeout)
+}
+
+func TestServer_ImmediateThenDelayedResponse(t *testing.T) {
+	delayed := make(chan string, 2)
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		delayed <- string(raw)
+	}))
+	defer rs.Close()
+
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		if err := r.Respond(Reply("first")); err != nil {
+			return err
+		}
+		return r.Respond(Reply("second"))
+	})
+	s := &Server{
+		Handler:             h,
+		AllowedResponseURLs: []string{rs.URL},
+	}
+
+	cmd := Command{ResponseURL: mustURL(rs.URL)}
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(ValuesFromCommand(cmd).Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, `{"text":"first"}`+"\n", resp.Body.String())
+
+	select {
+	case raw := <-delayed:
+		assert.Equal(t, `{"text":"second"}`, raw)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func mustURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		close(started)
+		<-release
+		close(finished)
+		return nil
+	})
+	s := &Server{
+		Handler:         h,
+		ResponseTimeout: time.Millisecond,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(resp, req)
+	<-started
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	// Wait for Shutdown to start rejecting new commands.
+	for {
+		s.mu.Lock()
+		inShutdown := s.inShutdown
+		s.mu.Unlock()
+		if inShutdown {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, `{"text":"I'm restarting right now, please try again in a moment."}`+"\n", resp.Body.String())
+
+	close(release)
+	assert.NoError(t, <-shutdown)
+
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Shutdown returned before the handler finished")
+	}
+}
+
+func TestServer_Shutdown_Timeout(t *testing.T) {
+	cancelled := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		<-ctx.Done()
+		close(cancelled)
+		return nil
+	})
+	s := &Server{
+		Handler:         h,
+		ResponseTimeout: time.Millisecond,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(resp, req)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := s.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler context was not cancelled")
+	}
+}
+
+func TestServer_RequestContext(t *testing.T) {
+	type userAgentKey struct{}
+
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		assert.False(t, ReceivedAt(ctx).IsZero())
+		assert.NotEqual(t, "", RequestID(ctx))
+		return r.Respond(Reply(ctx.Value(userAgentKey{}).(string)))
+	})
+	s := &Server{
+		Handler: h,
+		RequestContext: func(ctx context.Context, r *http.Request, command Command) context.Context {
+			assert.Equal(t, "/deploy", command.Command)
+			return context.WithValue(ctx, userAgentKey{}, r.UserAgent())
+		},
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "Slackbot 1.0")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, `{"text":"Slackbot 1.0"}`+"\n", resp.Body.String())
+}
+
+func TestServer_CommandTimeout(t *testing.T) {
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.Equal(t, ReceivedAt(ctx).Add(time.Minute), deadline)
+		return nil
+	})
+	s := &Server{
+		Handler:        h,
+		CommandTimeout: time.Minute,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestServer_CommandTimeout_Error(t *testing.T) {
+	delayed := make(chan string, 1)
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := ioutil.ReadAll(r.Body)
+		delayed <- string(raw)
+	}))
+	defer rs.Close()
+
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	s := &Server{
+		Handler:             h,
+		CommandTimeout:      10 * time.Millisecond,
+		ResponseTimeout:     time.Millisecond,
+		AllowedResponseURLs: []string{rs.URL},
+	}
+
+	cmd := Command{ResponseURL: mustURL(rs.URL)}
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(ValuesFromCommand(cmd).Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "", resp.Body.String())
+
+	select {
+	case raw := <-delayed:
+		assert.Equal(t, `{"text":"context deadline exceeded"}`, raw)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestServer_MaxConcurrency(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	s := &Server{
+		Handler:         h,
+		ResponseTimeout: time.Millisecond,
+		MaxConcurrency:  1,
+		QueueSize:       1,
+	}
+
+	// The first command runs, and the second is queued.
+	for i := 0; i < 2; i++ {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		s.ServeHTTP(resp, req)
+		assert.Equal(t, "", resp.Body.String())
+	}
+	<-started
+
+	// The third is rejected.
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, `{"text":"I'm busy right now, please try again in a moment."}`+"\n", resp.Body.String())
+
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+}
+
+func TestServer_MaxConcurrencyPerCommand(t *testing.T) {
+	started := make(chan string)
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		started <- command.Command
+		<-release
+		return nil
+	})
+	s := &Server{
+		Handler:                  h,
+		ResponseTimeout:          time.Millisecond,
+		MaxConcurrencyPerCommand: 1,
+		Busy: HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+			return r.Respond(Reply("busy"))
+		}),
+	}
+
+	serve := func(command string) string {
+		cmd := Command{Command: command, ResponseURL: mustURL("https://hooks.slack.com/commands/1234/5678")}
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(ValuesFromCommand(cmd).Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		s.ServeHTTP(resp, req)
+		return resp.Body.String()
+	}
+
+	assert.Equal(t, "", serve("/deploy"))
+	assert.Equal(t, "/deploy", <-started)
+
+	// Another /deploy is rejected, but other commands can still run.
+	assert.Equal(t, `{"text":"busy"}`+"\n", serve("/deploy"))
+	assert.Equal(t, "", serve("/weather"))
+	assert.Equal(t, "/weather", <-started)
+
+	release <- struct{}{}
+	release <- struct{}{}
+}
+
+func TestServer_MaxConcurrencyPerCommand_Unknown(t *testing.T) {
+	m := NewMux()
+	m.Command("/weather", "abcd", new(mockHandler))
+	s := &Server{
+		Handler:                  m,
+		MaxConcurrencyPerCommand: 1,
+	}
+
+	for i := 0; i < 100; i++ {
+		cmd := Command{Token: "abcd", Command: "/cmd" + strconv.Itoa(i), ResponseURL: mustURL("https://hooks.slack.com/commands/1234/5678")}
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/", strings.NewReader(ValuesFromCommand(cmd).Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		s.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// Limiters are removed once the commands finish.
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Empty(t, s.commandLimiters)
+}
+
+func TestServer_Client(t *testing.T) {
+	delayed := make(chan string, 1)
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delayed <- r.Header.Get("X-Instrumented")
+	}))
+	defer rs.Close()
+
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		<-release
+		return r.Respond(Reply("ok"))
+	})
+	s := &Server{
+		Handler:             h,
+		ResponseTimeout:     time.Millisecond,
+		AllowedResponseURLs: []string{rs.URL},
+		Client: &http.Client{
+			Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				req.Header.Set("X-Instrumented", "true")
+				return http.DefaultTransport.RoundTrip(req)
+			}),
+		},
+	}
+
+	cmd := Command{ResponseURL: mustURL(rs.URL)}
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(ValuesFromCommand(cmd).Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	close(release)
+
+	select {
+	case instrumented := <-delayed:
+		assert.Equal(t, "true", instrumented)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestServer_NewResponder(t *testing.T) {
+	r := new(mockResponder)
+	r.On("Respond", Reply("ok")).Return(nil)
+
+	release := make(chan struct{})
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		<-release
+		return r.Respond(Reply("ok"))
+	})
+	s := &Server{
+		Handler:         h,
+		ResponseTimeout: time.Millisecond,
+		NewResponder: func(ctx context.Context, command Command) Responder {
+			assert.Equal(t, "/deploy", command.Command)
+			return r
+		},
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	close(release)
+	s.Shutdown(context.Background())
+
+	r.AssertExpectations(t)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+func TestServer_AllowedResponseURLs(t *testing.T) {
+	called := make(chan struct{}, 1)
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		called <- struct{}{}
+		return nil
+	})
+	s := &Server{
+		Handler: h,
+	}
+
+	cmd := Command{ResponseURL: mustURL("http://169.254.169.254/latest/meta-data")}
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(ValuesFromCommand(cmd).Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "Invalid response_url.\n", resp.Body.String())
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.Len(t, called, 0, "handler should not be called")
+}
+
+func TestServer_MethodNotAllowed(t *testing.T) {
+	s := &Server{
+		Handler: new(mockHandler),
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+	assert.Equal(t, "POST", resp.Header().Get("Allow"))
+	assert.Equal(t, "Method not allowed.\n", resp.Body.String())
+}
+
+func TestServer_UnsupportedMediaType(t *testing.T) {
+	s := &Server{
+		Handler: new(mockHandler),
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+	assert.Equal(t, "Unsupported media type.\n", resp.Body.String())
+}
+
+func TestServer_RenderError(t *testing.T) {
+	s := &Server{
+		Handler:       new(mockHandler),
+		SigningSecret: "secret",
+		RenderError: func(w http.ResponseWriter, r *http.Request, err error) {
+			assert.Equal(t, ErrInvalidSignature, err)
+			w.WriteHeader(StatusCode(err))
+			io.WriteString(w, "Nope")
+		},
+	}
+
+	resp := httptest.NewRecorder()
+	req := newSignedRequest(testForm, "other", time.Now().Unix())
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Nope", resp.Body.String())
+}
+
+func TestServer_Err_UserMessage(t *testing.T) {
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		return &Error{Message: "Deploy failed.", Err: errors.New("git: exit status 128")}
+	})
+	s := &Server{
+		Handler: h,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, `{"text":"Deploy failed."}`+"\n", resp.Body.String())
+}
+
+func TestServer_EncodeError(t *testing.T) {
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		return r.Respond(Response{Text: "ok", Blocks: []Block{badBlock{}}})
+	})
+	s := &Server{
+		Handler: h,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header().Get("Content-Type"))
+	assert.Equal(t, "Bad Request\n", resp.Body.String())
+}
+
+// badBlock is a Block that can't be marshalled.
+type badBlock struct{}
+
+func (badBlock) BlockType() string { return "bad" }
+
+func (badBlock) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("boom")
+}
+
+func TestServer_Dispatch(t *testing.T) {
+	called := make(chan struct{}, 1)
+	h := HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		called <- struct{}{}
+		return nil
+	})
+	m := NewMux()
+	m.Command("/deploy", "abcd", h)
+	s := &Server{
+		Handler: m,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+}
+
+func TestServer_Dispatch_InvalidToken(t *testing.T) {
+	m := NewMux()
+	m.Command("/deploy", "other", new(mockHandler))
+	s := &Server{
+		Handler: m,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Equal(t, "Unauthorized.\n", resp.Body.String())
+}
+
+func TestServer_Dispatch_NotFound(t *testing.T) {
+	m := NewMux()
+	m.Command("/weather", "abcd", new(mockHandler))
+	s := &Server{
+		Handler: m,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `{"text":"Sorry, I don't know how to handle `+"`/deploy`"+`."}`+"\n", resp.Body.String())
+}
+
+func TestServer_Dispatch_NoHandler(t *testing.T) {
+	m := NewMux()
+	m.Command("/weather", "abcd", new(mockHandler))
+	m.NotFound = NoHandler
+	s := &Server{
+		Handler: m,
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	s.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
 }
@@ -0,0 +1,106 @@
+package slash
+
+import "golang.org/x/net/context"
+
+// limiter limits the number of commands that can be served concurrently, with
+// a bounded queue of commands waiting for a slot.
+type limiter struct {
+	// slots has a capacity of the maximum number of concurrent commands.
+	slots chan struct{}
+
+	// tickets has a capacity of the maximum number of concurrent commands,
+	// plus the size of the queue.
+	tickets chan struct{}
+}
+
+func newLimiter(max, queue int) *limiter {
+	return &limiter{
+		slots:   make(chan struct{}, max),
+		tickets: make(chan struct{}, max+queue),
+	}
+}
+
+// reserve reserves a place in the queue, returning false if the queue is full.
+func (l *limiter) reserve() bool {
+	select {
+	case l.tickets <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// cancel gives up a reservation without acquiring a slot.
+func (l *limiter) cancel() {
+	<-l.tickets
+}
+
+// acquire waits for a slot to become available. reserve must have been called
+// first.
+func (l *limiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release releases an acquired slot, and the reservation.
+func (l *limiter) release() {
+	<-l.slots
+	<-l.tickets
+}
+
+// commandLimiter is a limiter for a single command name, with a count of the
+// commands that are using it.
+type commandLimiter struct {
+	*limiter
+	refs int
+}
+
+// limiters is a group of limiters that must all be acquired to serve a
+// command.
+type limiters []*limiter
+
+// reserve reserves a place in the queue of all the limiters, returning false
+// if any of them are full.
+func (ls limiters) reserve() bool {
+	for i, l := range ls {
+		if !l.reserve() {
+			ls[:i].cancel()
+			return false
+		}
+	}
+	return true
+}
+
+func (ls limiters) cancel() {
+	for _, l := range ls {
+		l.cancel()
+	}
+}
+
+// limit returns a Handler that waits for a slot in all of the limiters before
+// serving the command. The limiters must have already been reserved.
+func (ls limiters) limit(h Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		for i, l := range ls {
+			if err := l.acquire(ctx); err != nil {
+				for _, l := range ls[:i] {
+					l.release()
+				}
+				ls[i:].cancel()
+				return err
+			}
+		}
+
+		defer func() {
+			for _, l := range ls {
+				l.release()
+			}
+		}()
+
+		return h.ServeCommand(ctx, r, command)
+	})
+}
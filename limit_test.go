@@ -0,0 +1,70 @@
+package slash
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1, 1)
+	ctx := context.Background()
+
+	assert.True(t, l.reserve())
+	assert.True(t, l.reserve())
+	assert.False(t, l.reserve())
+
+	assert.NoError(t, l.acquire(ctx))
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, l.acquire(ctx))
+
+	l.release()
+	assert.True(t, l.reserve())
+}
+
+func TestLimiters_Reserve(t *testing.T) {
+	a, b := newLimiter(1, 0), newLimiter(1, 0)
+	ls := limiters{a, b}
+
+	assert.True(t, b.reserve())
+	assert.False(t, ls.reserve())
+
+	// The reservation for a should have been given back.
+	assert.True(t, a.reserve())
+}
+
+func TestLimiters_Limit(t *testing.T) {
+	l := newLimiter(1, 1)
+	ls := limiters{l}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := ls.limit(HandlerFunc(func(ctx context.Context, r Responder, command Command) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}))
+
+	assert.True(t, ls.reserve())
+	go h.ServeCommand(context.Background(), nil, Command{})
+	<-started
+
+	assert.True(t, ls.reserve())
+	go h.ServeCommand(context.Background(), nil, Command{})
+
+	// Only one command should be running.
+	select {
+	case <-started:
+		t.Fatal("expected command to be queued")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+}
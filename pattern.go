@@ -0,0 +1,284 @@
+package slash
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pattern is a Matcher that matches the text of a command against a pattern
+// like "deploy {repo} to {env}". Patterns are made up of space separated
+// segments:
+//
+//	deploy        matches the word "deploy" exactly
+//	{repo}        matches any single argument, as the "repo" param
+//	{n:int}       matches an integer argument, as the "n" param
+//	{rest...}     matches the rest of the text, as the "rest" param
+//	[to {env}]    optionally matches the segments inside the brackets
+//
+// Arguments in the command text can be quoted with single or double quotes to
+// include spaces, like `deploy "my repo"`.
+type Pattern struct {
+	pattern  string
+	segments []segment
+}
+
+type segmentKind int
+
+const (
+	literalSegment segmentKind = iota
+	paramSegment
+	restSegment
+	optionalSegment
+)
+
+// segment is a single part of a Pattern.
+type segment struct {
+	kind segmentKind
+
+	// The word for a literal segment, or the param name.
+	value string
+
+	// The type of a param segment, or "" for any string.
+	typ string
+
+	// The segments inside of an optional segment.
+	segments []segment
+}
+
+// Placeholders look like {name}, {name:type} or {name...}.
+var placeholderRegex = regexp.MustCompile(`^\{([A-Za-z_][A-Za-z0-9_]*)(?::([a-z]+)|(\.\.\.))?\}$`)
+
+// ParsePattern parses a Pattern.
+func ParsePattern(pattern string) (*Pattern, error) {
+	segments, rest, err := parseSegments(pattern, false)
+	if err != nil {
+		return nil, fmt.Errorf("slash: invalid pattern %q: %v", pattern, err)
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("slash: invalid pattern %q: unexpected ]", pattern)
+	}
+	for i, s := range segments {
+		if s.kind == restSegment && i != len(segments)-1 {
+			return nil, fmt.Errorf("slash: invalid pattern %q: {%s...} must be the last segment", pattern, s.value)
+		}
+	}
+	return &Pattern{pattern: pattern, segments: segments}, nil
+}
+
+// MatchPattern returns a Matcher that checks that the command text matches the
+// pattern. It panics if the pattern can't be parsed. See Pattern for the
+// syntax.
+func MatchPattern(pattern string) Matcher {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source text of the pattern.
+func (p *Pattern) String() string {
+	return p.pattern
+}
+
+// Match implements the Matcher interface.
+func (p *Pattern) Match(command Command) (map[string]string, bool) {
+	params, ok := matchSegments(p.segments, command.Text, tokenize(command.Text), make(map[string]string))
+	if !ok {
+		return make(map[string]string), false
+	}
+	return params, true
+}
+
+// matchSegments matches the segments against the tokens, trying with and
+// without optional segments.
+func matchSegments(segments []segment, text string, tokens []token, params map[string]string) (map[string]string, bool) {
+	if len(segments) == 0 {
+		return params, len(tokens) == 0
+	}
+
+	s := segments[0]
+	switch s.kind {
+	case literalSegment:
+		if len(tokens) == 0 || tokens[0].value != s.value {
+			return nil, false
+		}
+		return matchSegments(segments[1:], text, tokens[1:], params)
+	case paramSegment:
+		if len(tokens) == 0 || !matchType(s.typ, tokens[0].value) {
+			return nil, false
+		}
+		params = copyParams(params)
+		params[s.value] = tokens[0].value
+		return matchSegments(segments[1:], text, tokens[1:], params)
+	case restSegment:
+		params = copyParams(params)
+		params[s.value] = ""
+		if len(tokens) > 0 {
+			params[s.value] = strings.TrimSpace(text[tokens[0].start:])
+		}
+		return params, true
+	case optionalSegment:
+		with := append(append([]segment(nil), s.segments...), segments[1:]...)
+		if params, ok := matchSegments(with, text, tokens, params); ok {
+			return params, true
+		}
+		return matchSegments(segments[1:], text, tokens, params)
+	}
+
+	return nil, false
+}
+
+func matchType(typ, value string) bool {
+	switch typ {
+	case "int":
+		_, err := strconv.Atoi(value)
+		return err == nil
+	default:
+		return true
+	}
+}
+
+func copyParams(params map[string]string) map[string]string {
+	c := make(map[string]string, len(params)+1)
+	for k, v := range params {
+		c[k] = v
+	}
+	return c
+}
+
+// parseSegments parses segments until the end of the pattern, or a closing ]
+// if optional is true. The unparsed remainder of the pattern is returned.
+func parseSegments(pattern string, optional bool) ([]segment, string, error) {
+	var segments []segment
+
+	for {
+		pattern = strings.TrimLeftFunc(pattern, unicode.IsSpace)
+
+		switch {
+		case pattern == "":
+			if optional {
+				return nil, "", fmt.Errorf("missing ]")
+			}
+			return segments, "", nil
+		case pattern[0] == ']':
+			if !optional {
+				return segments, pattern, nil
+			}
+			return segments, pattern[1:], nil
+		case pattern[0] == '[':
+			inner, rest, err := parseSegments(pattern[1:], true)
+			if err != nil {
+				return nil, "", err
+			}
+			if len(inner) == 0 {
+				return nil, "", fmt.Errorf("empty []")
+			}
+			for _, s := range inner {
+				if s.kind == restSegment {
+					return nil, "", fmt.Errorf("{%s...} can't be optional", s.value)
+				}
+			}
+			segments = append(segments, segment{kind: optionalSegment, segments: inner})
+			pattern = rest
+		default:
+			i := strings.IndexFunc(pattern, func(r rune) bool {
+				return unicode.IsSpace(r) || r == '[' || r == ']'
+			})
+			if i < 0 {
+				i = len(pattern)
+			}
+
+			s, err := parseSegment(pattern[:i])
+			if err != nil {
+				return nil, "", err
+			}
+			segments = append(segments, s)
+			pattern = pattern[i:]
+		}
+	}
+}
+
+func parseSegment(word string) (segment, error) {
+	if !strings.ContainsAny(word, "{}") {
+		return segment{kind: literalSegment, value: word}, nil
+	}
+
+	m := placeholderRegex.FindStringSubmatch(word)
+	if m == nil {
+		return segment{}, fmt.Errorf("invalid placeholder %s", word)
+	}
+
+	name, typ, rest := m[1], m[2], m[3]
+	switch {
+	case rest != "":
+		return segment{kind: restSegment, value: name}, nil
+	case typ == "" || typ == "int":
+		return segment{kind: paramSegment, value: name, typ: typ}, nil
+	default:
+		return segment{}, fmt.Errorf("unknown type %q in %s", typ, word)
+	}
+}
+
+// token is an argument in the text of a command.
+type token struct {
+	// The value of the argument, with any quotes removed.
+	value string
+
+	// Byte offsets of the argument in the text.
+	start, end int
+}
+
+// Opening quotes, and their closing counterparts. Slack clients may convert
+// straight quotes into curly ones.
+var quotes = map[rune]rune{
+	'"':  '"',
+	'\'': '\'',
+	'“':  '”',
+	'‘':  '’',
+}
+
+// tokenize splits the text into space separated arguments. Arguments that start
+// with a quote extend until the closing quote, or the end of the text.
+func tokenize(text string) []token {
+	var tokens []token
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			i += size
+			continue
+		}
+
+		start := i
+		var value strings.Builder
+		if end, ok := quotes[r]; ok {
+			i += size
+			for i < len(text) {
+				r, size = utf8.DecodeRuneInString(text[i:])
+				i += size
+				if r == end {
+					break
+				}
+				value.WriteRune(r)
+			}
+		} else {
+			for i < len(text) {
+				r, size = utf8.DecodeRuneInString(text[i:])
+				if unicode.IsSpace(r) {
+					break
+				}
+				value.WriteRune(r)
+				i += size
+			}
+		}
+
+		tokens = append(tokens, token{value: value.String(), start: start, end: i})
+	}
+
+	return tokens
+}
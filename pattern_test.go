@@ -0,0 +1,120 @@
+package slash
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		params  map[string]string
+		ok      bool
+	}{
+		{"deploy {repo} to {env}", "deploy acme-inc to staging", map[string]string{"repo": "acme-inc", "env": "staging"}, true},
+		{"deploy {repo} to {env}", "  deploy   acme-inc to  staging ", map[string]string{"repo": "acme-inc", "env": "staging"}, true},
+		{"deploy {repo} to {env}", "deploy acme-inc staging", nil, false},
+		{"deploy {repo} to {env}", "deploy acme-inc to staging now", nil, false},
+		{"deploy {repo} to {env}", "deployed acme-inc to staging", nil, false},
+		{"deploy {repo} to {env}", "", nil, false},
+
+		// Quoted arguments
+		{"deploy {repo} to {env}", `deploy "acme inc" to 'staging'`, map[string]string{"repo": "acme inc", "env": "staging"}, true},
+		{"deploy {repo} to {env}", "deploy “acme inc” to staging", map[string]string{"repo": "acme inc", "env": "staging"}, true},
+		{"deploy {repo} to {env}", `deploy "" to staging`, map[string]string{"repo": "", "env": "staging"}, true},
+		{"deploy {repo} to {env}", `deploy "acme inc to staging`, nil, false},
+
+		// Typed placeholders
+		{"scale {app} {n:int}", "scale web 10", map[string]string{"app": "web", "n": "10"}, true},
+		{"scale {app} {n:int}", "scale web -1", map[string]string{"app": "web", "n": "-1"}, true},
+		{"scale {app} {n:int}", "scale web ten", nil, false},
+
+		// Rest placeholders
+		{"echo {rest...}", `echo hello   "big" world`, map[string]string{"rest": `hello   "big" world`}, true},
+		{"echo {rest...}", "echo", map[string]string{"rest": ""}, true},
+		{"{rest...}", "anything at all", map[string]string{"rest": "anything at all"}, true},
+
+		// Optional segments
+		{"deploy {repo} [to {env}]", "deploy acme-inc", map[string]string{"repo": "acme-inc"}, true},
+		{"deploy {repo} [to {env}]", "deploy acme-inc to staging", map[string]string{"repo": "acme-inc", "env": "staging"}, true},
+		{"deploy {repo} [to {env}]", "deploy acme-inc to", nil, false},
+		{"deploy [{repo}] [to {env}]", "deploy to staging", map[string]string{"env": "staging"}, true},
+		{"deploy [{ref}] {repo}", "deploy acme-inc", map[string]string{"repo": "acme-inc"}, true},
+		{"deploy [{ref}] {repo}", "deploy master acme-inc", map[string]string{"ref": "master", "repo": "acme-inc"}, true},
+		{"logs {app} [tail [{n:int}]]", "logs web tail 10", map[string]string{"app": "web", "n": "10"}, true},
+		{"logs {app} [tail [{n:int}]]", "logs web tail", map[string]string{"app": "web"}, true},
+		{"logs {app} [tail [{n:int}]]", "logs web tail ten", nil, false},
+	}
+
+	for _, tt := range tests {
+		params, ok := MatchPattern(tt.pattern).Match(Command{Text: tt.text})
+		assert.Equal(t, tt.ok, ok, "%q %q", tt.pattern, tt.text)
+		if tt.ok {
+			assert.Equal(t, tt.params, params, "%q %q", tt.pattern, tt.text)
+		}
+	}
+}
+
+func TestParsePattern_Invalid(t *testing.T) {
+	tests := []string{
+		"deploy {repo",
+		"deploy repo}",
+		"deploy {}",
+		"deploy {1repo}",
+		"deploy {repo:float}",
+		"deploy {repo}s",
+		"deploy [to {env}",
+		"deploy to {env}]",
+		"deploy []",
+		"echo {rest...} foo",
+		"echo [{rest...}]",
+	}
+
+	for _, pattern := range tests {
+		_, err := ParsePattern(pattern)
+		assert.Error(t, err, pattern)
+	}
+
+	assert.Panics(t, func() {
+		MatchPattern("deploy {repo")
+	})
+}
+
+func TestMux_Pattern(t *testing.T) {
+	r := new(mockResponder)
+	h := new(mockHandler)
+	m := NewMux()
+	m.Pattern("deploy {repo} to {env}", h)
+
+	cmd := Command{
+		Text: "deploy acme-inc to staging",
+	}
+
+	ctx := context.Background()
+	h.On("ServeCommand",
+		WithParams(ctx, map[string]string{"repo": "acme-inc", "env": "staging"}),
+		r,
+		cmd,
+	).Return(Reply(""), nil)
+
+	err := m.ServeCommand(ctx, r, cmd)
+	assert.NoError(t, err)
+
+	h.AssertExpectations(t)
+}
+
+func TestTokenize(t *testing.T) {
+	text := ` deploy "acme inc" to 'staging env' now's `
+	tokens := tokenize(text)
+
+	var values []string
+	for _, tok := range tokens {
+		values = append(values, tok.value)
+	}
+	assert.Equal(t, []string{"deploy", "acme inc", "to", "staging env", "now's"}, values)
+	assert.Equal(t, `"acme inc"`, text[tokens[1].start:tokens[1].end])
+}
@@ -0,0 +1,173 @@
+package slash
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is the default minimum amount of time between
+// progress updates.
+const DefaultProgressInterval = 2 * time.Second
+
+// ErrProgressDone is returned when Progress is used after Done has been
+// called.
+var ErrProgressDone = errors.New("slash: progress is done")
+
+// Progress wraps a Responder to report the progress of a long running command
+// without exceeding MaximumDelayedResponses. Updates are coalesced and
+// throttled so that only the latest one is sent at most once per Interval.
+// After the first update, updates and the final result passed to Done replace
+// the original message, and the last response is always reserved for the final
+// result.
+//
+// If the Responder is Budgeted, its remaining responses are used as the
+// budget, otherwise Progress assumes it can send MaximumDelayedResponses.
+type Progress struct {
+	// Interval is the minimum amount of time between updates.
+	Interval time.Duration
+
+	r Responder
+
+	mu sync.Mutex
+	// Signalled when an update finishes sending.
+	cond    *sync.Cond
+	sent    int
+	last    time.Time
+	pending *Response
+	timer   *time.Timer
+	sending bool
+	done    bool
+	err     error
+}
+
+// NewProgress returns a new Progress instance that sends responses with r.
+func NewProgress(r Responder) *Progress {
+	p := &Progress{
+		Interval: DefaultProgressInterval,
+		r:        r,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Update reports progress. The Response may not be sent immediately, and may
+// be dropped in favor of a later update. If a previous update failed to send,
+// its error is returned.
+func (p *Progress) Update(resp Response) error {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return ErrProgressDone
+	}
+	p.pending = &resp
+	next := p.next()
+	p.mu.Unlock()
+
+	p.send(next)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.err
+	p.err = nil
+	return err
+}
+
+// Done sends the final result, discarding any updates that haven't been sent
+// yet. If an update was sent, the result replaces it. If sending the result
+// succeeds, but a previous update failed to send, the update's error is
+// returned.
+func (p *Progress) Done(resp Response) error {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return ErrProgressDone
+	}
+
+	p.done = true
+	p.pending = nil
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	// Wait for an update that's being sent, so that it doesn't replace
+	// the result.
+	for p.sending {
+		p.cond.Wait()
+	}
+	if p.sent > 0 {
+		resp.ReplaceOriginal = true
+	}
+	err := p.err
+	p.err = nil
+	p.mu.Unlock()
+
+	if rerr := p.r.Respond(resp); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// next returns the pending update if it can be sent now, or schedules it to be
+// sent later. The caller must send the returned update with send. It must be
+// called with the lock held.
+func (p *Progress) next() *Response {
+	if p.pending == nil || p.sending || p.done {
+		return nil
+	}
+
+	// Always keep the last response for the final result.
+	left := remaining(p.r)
+	if left < 0 {
+		left = MaximumDelayedResponses - p.sent
+	}
+	if left <= 1 {
+		return nil
+	}
+
+	if wait := p.Interval - time.Since(p.last); wait > 0 {
+		if p.timer == nil {
+			p.timer = time.AfterFunc(wait, p.tick)
+		}
+		return nil
+	}
+
+	resp := *p.pending
+	p.pending = nil
+	if p.sent > 0 {
+		resp.ReplaceOriginal = true
+	}
+
+	p.sent++
+	p.last = time.Now()
+	p.sending = true
+	return &resp
+}
+
+// send sends an update returned by next without holding the lock, and then
+// any update that became pending while it was being sent.
+func (p *Progress) send(resp *Response) {
+	for resp != nil {
+		err := p.r.Respond(*resp)
+
+		p.mu.Lock()
+		p.sending = false
+		if err != nil {
+			p.err = err
+		}
+		p.cond.Broadcast()
+		resp = p.next()
+		p.mu.Unlock()
+	}
+}
+
+// tick is called by the timer to send a scheduled update.
+func (p *Progress) tick() {
+	p.mu.Lock()
+	p.timer = nil
+	next := p.next()
+	p.mu.Unlock()
+
+	p.send(next)
+}
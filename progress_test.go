@@ -0,0 +1,206 @@
+package slash
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	r := new(recordingResponder)
+	p := NewProgress(r)
+	p.Interval = 0
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, p.Update(Reply("working")))
+	}
+	assert.NoError(t, p.Done(Reply("done")))
+
+	// 4 updates, with the last slot reserved for the final result.
+	assert.Equal(t, []Response{
+		{Text: "working"},
+		{Text: "working", ReplaceOriginal: true},
+		{Text: "working", ReplaceOriginal: true},
+		{Text: "working", ReplaceOriginal: true},
+		{Text: "done", ReplaceOriginal: true},
+	}, r.responses())
+
+	assert.Equal(t, ErrProgressDone, p.Update(Reply("working")))
+	assert.Equal(t, ErrProgressDone, p.Done(Reply("done")))
+}
+
+func TestProgress_Coalesce(t *testing.T) {
+	r := new(recordingResponder)
+	p := NewProgress(r)
+	p.Interval = 20 * time.Millisecond
+
+	assert.NoError(t, p.Update(Reply("1")))
+	assert.NoError(t, p.Update(Reply("2")))
+	assert.NoError(t, p.Update(Reply("3")))
+	assert.Equal(t, []Response{{Text: "1"}}, r.responses())
+
+	// The latest update is sent once the interval has elapsed.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []Response{
+		{Text: "1"},
+		{Text: "3", ReplaceOriginal: true},
+	}, r.responses())
+
+	assert.NoError(t, p.Done(Reply("done")))
+	assert.Equal(t, []Response{
+		{Text: "1"},
+		{Text: "3", ReplaceOriginal: true},
+		{Text: "done", ReplaceOriginal: true},
+	}, r.responses())
+}
+
+func TestProgress_Done_DiscardsPending(t *testing.T) {
+	r := new(recordingResponder)
+	p := NewProgress(r)
+	p.Interval = 20 * time.Millisecond
+
+	assert.NoError(t, p.Update(Reply("1")))
+	assert.NoError(t, p.Update(Reply("2")))
+	assert.NoError(t, p.Done(Reply("done")))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, []Response{
+		{Text: "1"},
+		{Text: "done", ReplaceOriginal: true},
+	}, r.responses())
+}
+
+func TestProgress_Done_NoUpdates(t *testing.T) {
+	r := new(recordingResponder)
+	p := NewProgress(r)
+
+	// There's no progress message to replace.
+	assert.NoError(t, p.Done(Reply("done")))
+	assert.Equal(t, []Response{{Text: "done"}}, r.responses())
+}
+
+func TestProgress_Err(t *testing.T) {
+	boom := errors.New("boom")
+	r := &recordingResponder{err: boom}
+	p := NewProgress(r)
+
+	assert.Equal(t, boom, p.Update(Reply("1")))
+}
+
+func TestProgress_Budgeted(t *testing.T) {
+	r := &budgetedResponder{recordingResponder: new(recordingResponder), max: MaximumDelayedResponses}
+	r.Respond(Reply("1"))
+	r.Respond(Reply("2"))
+	r.Respond(Reply("3"))
+
+	p := NewProgress(r)
+	p.Interval = 0
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, p.Update(Reply("working")))
+	}
+	assert.NoError(t, p.Done(Reply("done")))
+
+	// Only one update fits before the slot reserved for the result.
+	assert.Equal(t, []Response{
+		{Text: "1"},
+		{Text: "2"},
+		{Text: "3"},
+		{Text: "working"},
+		{Text: "done", ReplaceOriginal: true},
+	}, r.responses())
+}
+
+func TestProgress_SendWithoutLock(t *testing.T) {
+	release := make(chan struct{})
+	r := &blockingResponder{
+		recordingResponder: new(recordingResponder),
+		release:            release,
+		started:            make(chan struct{}),
+	}
+	p := NewProgress(r)
+	p.Interval = 0
+
+	sent := make(chan error)
+	go func() {
+		sent <- p.Update(Reply("1"))
+	}()
+	<-r.started
+
+	// Updates don't wait for the update that's being sent.
+	assert.NoError(t, p.Update(Reply("2")))
+
+	close(release)
+	assert.NoError(t, <-sent)
+	assert.NoError(t, p.Done(Reply("done")))
+
+	assert.Equal(t, []Response{
+		{Text: "1"},
+		{Text: "2", ReplaceOriginal: true},
+		{Text: "done", ReplaceOriginal: true},
+	}, r.responses())
+}
+
+func TestProgress_Done_Err(t *testing.T) {
+	boom := errors.New("boom")
+	r := new(recordingResponder)
+	p := NewProgress(r)
+	p.Interval = 20 * time.Millisecond
+
+	assert.NoError(t, p.Update(Reply("1")))
+
+	// The scheduled update fails to send.
+	r.mu.Lock()
+	r.err = boom
+	r.mu.Unlock()
+	assert.NoError(t, p.Update(Reply("2")))
+	time.Sleep(50 * time.Millisecond)
+
+	r.mu.Lock()
+	r.err = nil
+	r.mu.Unlock()
+	assert.Equal(t, boom, p.Done(Reply("done")))
+}
+
+// blockingResponder is a recordingResponder that blocks on the first response
+// until release is closed.
+type blockingResponder struct {
+	*recordingResponder
+	release chan struct{}
+	started chan struct{}
+	once    sync.Once
+}
+
+func (r *blockingResponder) Respond(resp Response) error {
+	first := false
+	r.once.Do(func() { first = true })
+	if first {
+		close(r.started)
+		<-r.release
+	}
+	return r.recordingResponder.Respond(resp)
+}
+
+// recordingResponder is a Responder that records the responses it sends.
+type recordingResponder struct {
+	err error
+
+	mu sync.Mutex
+	rs []Response
+}
+
+func (r *recordingResponder) Respond(resp Response) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rs = append(r.rs, resp)
+	return r.err
+}
+
+func (r *recordingResponder) responses() []Response {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Response(nil), r.rs...)
+}
@@ -0,0 +1,113 @@
+package slash
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers and version used when signing requests. See
+// https://api.slack.com/authentication/verifying-requests-from-slack
+const (
+	SignatureHeader = "X-Slack-Signature"
+	TimestampHeader = "X-Slack-Request-Timestamp"
+
+	signatureVersion = "v0"
+)
+
+// MaxBodySize is the maximum size of a request body that VerifyRequest will
+// read. It matches the limit that http.Request.ParseForm applies.
+const MaxBodySize = 10 << 20
+
+// DefaultMaxClockSkew is the default amount of time that the request
+// timestamp is allowed to differ from the local clock. Slack recommends
+// rejecting anything older than 5 minutes to mitigate replay attacks.
+const DefaultMaxClockSkew = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned when the X-Slack-Signature header is
+	// missing, or does not match the signature computed with the signing
+	// secret.
+	ErrInvalidSignature error = &Error{
+		Status:  http.StatusUnauthorized,
+		Message: "Unauthorized.",
+		Err:     errors.New("slash: invalid signature"),
+	}
+
+	// ErrInvalidTimestamp is returned when the X-Slack-Request-Timestamp
+	// header is missing, or is outside of the allowed clock skew.
+	ErrInvalidTimestamp error = &Error{
+		Status:  http.StatusUnauthorized,
+		Message: "Unauthorized.",
+		Err:     errors.New("slash: invalid request timestamp"),
+	}
+
+	// ErrRequestTooLarge is returned when the request body is larger than
+	// MaxBodySize.
+	ErrRequestTooLarge error = &Error{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: "Request too large.",
+		Err:     errors.New("slash: request body too large"),
+	}
+)
+
+// VerifyRequest verifies that the request was signed by Slack using the given
+// signing secret, and that the request timestamp is within maxSkew of the
+// local clock. The request body is read and then restored, so the request can
+// still be parsed with ParseRequest afterwards. Bodies larger than MaxBodySize
+// are rejected with ErrRequestTooLarge.
+func VerifyRequest(r *http.Request, secret string, maxSkew time.Duration) error {
+	// If an empty string was provided, this was probably a configuration
+	// error, so return unauthorized for safety.
+	if secret == "" {
+		return ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	if d := time.Since(time.Unix(ts, 0)); d > maxSkew || d < -maxSkew {
+		return ErrInvalidTimestamp
+	}
+
+	var body []byte
+	if r.Body != nil {
+		// The body isn't authenticated yet, so don't buffer more than
+		// MaxBodySize.
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, MaxBodySize+1))
+		if err != nil {
+			return err
+		}
+		r.Body.Close()
+		if len(body) > MaxBodySize {
+			return ErrRequestTooLarge
+		}
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	expected := Signature(secret, ts, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(SignatureHeader))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Signature returns the value of the X-Slack-Signature header for the given
+// timestamp and request body. This is mostly useful for testing.
+func Signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%d:", signatureVersion, timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("%s=%s", signatureVersion, hex.EncodeToString(mac.Sum(nil)))
+}
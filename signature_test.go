@@ -0,0 +1,83 @@
+package slash
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	ts := time.Now().Unix()
+	req := newSignedRequest(testForm, "secret", ts)
+
+	err := VerifyRequest(req, "secret", DefaultMaxClockSkew)
+	assert.NoError(t, err)
+
+	// The body should still be readable.
+	raw, err := ioutil.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, testForm, string(raw))
+}
+
+func TestVerifyRequest_InvalidSignature(t *testing.T) {
+	ts := time.Now().Unix()
+
+	req := newSignedRequest(testForm, "other", ts)
+	err := VerifyRequest(req, "secret", DefaultMaxClockSkew)
+	assert.Equal(t, ErrInvalidSignature, err)
+
+	req = newSignedRequest(testForm, "secret", ts)
+	req.Header.Del(SignatureHeader)
+	err = VerifyRequest(req, "secret", DefaultMaxClockSkew)
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestVerifyRequest_TooLarge(t *testing.T) {
+	body := testForm + "&text=" + strings.Repeat("a", MaxBodySize)
+	req := newSignedRequest(body, "secret", time.Now().Unix())
+	err := VerifyRequest(req, "secret", DefaultMaxClockSkew)
+	assert.Equal(t, ErrRequestTooLarge, err)
+}
+
+func TestVerifyRequest_EmptySecret(t *testing.T) {
+	req := newSignedRequest(testForm, "", time.Now().Unix())
+	err := VerifyRequest(req, "", DefaultMaxClockSkew)
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestVerifyRequest_InvalidTimestamp(t *testing.T) {
+	ts := time.Now().Add(-10 * time.Minute).Unix()
+	req := newSignedRequest(testForm, "secret", ts)
+	err := VerifyRequest(req, "secret", DefaultMaxClockSkew)
+	assert.Equal(t, ErrInvalidTimestamp, err)
+
+	ts = time.Now().Add(10 * time.Minute).Unix()
+	req = newSignedRequest(testForm, "secret", ts)
+	err = VerifyRequest(req, "secret", DefaultMaxClockSkew)
+	assert.Equal(t, ErrInvalidTimestamp, err)
+
+	req = newSignedRequest(testForm, "secret", time.Now().Unix())
+	req.Header.Del(TimestampHeader)
+	err = VerifyRequest(req, "secret", DefaultMaxClockSkew)
+	assert.Equal(t, ErrInvalidTimestamp, err)
+}
+
+func TestSignature(t *testing.T) {
+	// Example from https://api.slack.com/authentication/verifying-requests-from-slack
+	body := "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	sig := Signature("8f742231b10e8888abcd99yyyzzz85a5", 1531420618, []byte(body))
+	assert.Equal(t, "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503", sig)
+}
+
+func newSignedRequest(body, secret string, ts int64) *http.Request {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, Signature(secret, ts, []byte(body)))
+	return req
+}
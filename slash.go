@@ -1,8 +1,12 @@
 package slash
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
@@ -18,6 +22,23 @@ const (
 	// We can only send a maximum of 5 delayed responses with the
 	// response_url.
 	MaximumDelayedResponses = 5
+
+	// The response_url can only be used for up to 30 minutes after the
+	// command was invoked.
+	ResponseURLLifetime = 30 * time.Minute
+
+	// Slack recommends keeping the text of a message under 4,000
+	// characters, and truncates anything much longer.
+	MaximumTextLength = 4000
+)
+
+// Values of ChannelName for channels that aren't public.
+const (
+	ChannelNameDirectMessage = "directmessage"
+	ChannelNamePrivateGroup  = "privategroup"
+
+	// Multi-party direct messages have a channel name prefixed with this.
+	channelNameMPDMPrefix = "mpdm-"
 )
 
 // Command represents an incoming Slash Command request.
@@ -27,6 +48,10 @@ type Command struct {
 	TeamID     string
 	TeamDomain string
 
+	EnterpriseID        string
+	EnterpriseName      string
+	IsEnterpriseInstall bool
+
 	ChannelID   string
 	ChannelName string
 
@@ -36,13 +61,78 @@ type Command struct {
 	Command string
 	Text    string
 
+	APIAppID  string
+	TriggerID string
+
 	ResponseURL *url.URL
+
+	// raw is the encoded form of all of the fields that were sent in the
+	// request. It's stored encoded so that Command stays comparable.
+	raw string
+}
+
+// RawValues returns all of the fields that were sent in the request, including
+// any that aren't extracted into the Command.
+func (c Command) RawValues() url.Values {
+	v, _ := url.ParseQuery(c.raw)
+	return v
+}
+
+// IsDirectMessage returns true if the command was invoked in a direct message
+// with a single user.
+func (c Command) IsDirectMessage() bool {
+	return c.ChannelName == ChannelNameDirectMessage
+}
+
+// IsMultiPartyDirectMessage returns true if the command was invoked in a
+// direct message with multiple users.
+func (c Command) IsMultiPartyDirectMessage() bool {
+	return strings.HasPrefix(c.ChannelName, channelNameMPDMPrefix)
+}
+
+// IsPrivateChannel returns true if the command was invoked in a private
+// channel.
+func (c Command) IsPrivateChannel() bool {
+	return c.ChannelName == ChannelNamePrivateGroup
 }
 
 // Response represents the response to send back to the user.
 type Response struct {
 	InChannel bool
 	Text      string
+
+	// Blocks are Block Kit blocks to render the message with. When blocks
+	// are provided, Text is used as the fallback for notifications.
+	Blocks []Block
+
+	// Attachments are legacy message attachments.
+	Attachments []Attachment
+
+	// ReplaceOriginal replaces the message that was previously sent in
+	// response to the command, instead of sending a new message.
+	ReplaceOriginal bool
+
+	// DeleteOriginal deletes the message that was previously sent in
+	// response to the command.
+	DeleteOriginal bool
+
+	// ThreadTS is the ts of a message to reply to in a thread.
+	ThreadTS string
+
+	// Mrkdwn controls whether Text is formatted with mrkdwn. When nil,
+	// Slack's default is used.
+	Mrkdwn *bool
+
+	// UnfurlLinks and UnfurlMedia control whether links and media in Text
+	// are unfurled. When nil, Slack's default is used.
+	UnfurlLinks *bool
+	UnfurlMedia *bool
+}
+
+// Bool returns a pointer to the bool value. This is useful for setting the
+// optional fields of a Response.
+func Bool(v bool) *bool {
+	return &v
 }
 
 // An empty response.
@@ -65,6 +155,28 @@ func Say(text string) Response {
 	}
 }
 
+// ReplyBlocks is like Reply, but includes Block Kit blocks. An error is
+// returned if there are more than MaximumBlocks.
+func ReplyBlocks(text string, blocks ...Block) (Response, error) {
+	if err := checkBlocks(blocks); err != nil {
+		return Response{}, err
+	}
+	resp := Reply(text)
+	resp.Blocks = blocks
+	return resp, nil
+}
+
+// SayBlocks is like Say, but includes Block Kit blocks. An error is returned if
+// there are more than MaximumBlocks.
+func SayBlocks(text string, blocks ...Block) (Response, error) {
+	if err := checkBlocks(blocks); err != nil {
+		return Response{}, err
+	}
+	resp := Say(text)
+	resp.Blocks = blocks
+	return resp, nil
+}
+
 // CommandFromValues returns a Command object from a url.Values object.
 func CommandFromValues(v url.Values) (Command, error) {
 	u, err := url.Parse(v.Get("response_url"))
@@ -73,37 +185,104 @@ func CommandFromValues(v url.Values) (Command, error) {
 	}
 
 	return Command{
-		Token:       v.Get("token"),
-		TeamID:      v.Get("team_id"),
-		TeamDomain:  v.Get("team_domain"),
-		ChannelID:   v.Get("channel_id"),
-		ChannelName: v.Get("channel_name"),
-		UserID:      v.Get("user_id"),
-		UserName:    v.Get("user_name"),
-		Command:     v.Get("command"),
-		Text:        v.Get("text"),
-		ResponseURL: u,
+		Token:               v.Get("token"),
+		TeamID:              v.Get("team_id"),
+		TeamDomain:          v.Get("team_domain"),
+		EnterpriseID:        v.Get("enterprise_id"),
+		EnterpriseName:      v.Get("enterprise_name"),
+		IsEnterpriseInstall: v.Get("is_enterprise_install") == "true",
+		ChannelID:           v.Get("channel_id"),
+		ChannelName:         v.Get("channel_name"),
+		UserID:              v.Get("user_id"),
+		UserName:            v.Get("user_name"),
+		Command:             v.Get("command"),
+		Text:                v.Get("text"),
+		APIAppID:            v.Get("api_app_id"),
+		TriggerID:           v.Get("trigger_id"),
+		ResponseURL:         u,
+		raw:                 v.Encode(),
 	}, nil
 }
 
-// ValuesFromCommand returns a url.Values from the Command object. This is
+// ValuesFromCommand returns a url.Values from the Command object. Any fields in
+// RawValues that aren't extracted into the Command are included as is. This is
 // mostly usefuly for testing.
 func ValuesFromCommand(cmd Command) url.Values {
-	v := make(url.Values)
+	v := cmd.RawValues()
 	v.Set("token", cmd.Token)
 	v.Set("team_id", cmd.TeamID)
 	v.Set("team_domain", cmd.TeamDomain)
+	setOptional(v, "enterprise_id", cmd.EnterpriseID)
+	setOptional(v, "enterprise_name", cmd.EnterpriseName)
+	if cmd.IsEnterpriseInstall {
+		v.Set("is_enterprise_install", "true")
+	} else if _, ok := v["is_enterprise_install"]; ok {
+		v.Set("is_enterprise_install", "false")
+	}
 	v.Set("channel_id", cmd.ChannelID)
 	v.Set("channel_name", cmd.ChannelName)
 	v.Set("user_id", cmd.UserID)
 	v.Set("user_name", cmd.UserName)
 	v.Set("command", cmd.Command)
 	v.Set("text", cmd.Text)
+	setOptional(v, "api_app_id", cmd.APIAppID)
+	setOptional(v, "trigger_id", cmd.TriggerID)
 	v.Set("response_url", cmd.ResponseURL.String())
 	return v
 }
 
-// ParseRequest parses the form an then returns the extracted Command.
+// setOptional sets the key to value, or removes it if value is empty.
+func setOptional(v url.Values, key, value string) {
+	if value == "" {
+		v.Del(key)
+		return
+	}
+	v.Set(key, value)
+}
+
+// DefaultAllowedResponseURLs are the response_url schemes and hosts that are
+// allowed when none are configured.
+var DefaultAllowedResponseURLs = []string{"https://hooks.slack.com"}
+
+// InvalidResponseURLError is the underlying error when the response_url of a
+// command does not match any of the allowed schemes and hosts. Posting
+// responses to it could allow a forged request to make the bot send data to an
+// arbitrary host.
+type InvalidResponseURLError struct {
+	URL *url.URL
+}
+
+func (e *InvalidResponseURLError) Error() string {
+	return fmt.Sprintf("slash: response_url not allowed: %s", e.URL)
+}
+
+// ValidateResponseURL checks that the scheme and host of u match one of the
+// allowed urls, such as "https://hooks.slack.com". If not, an *Error wrapping
+// an *InvalidResponseURLError is returned, so that the url isn't shown to the
+// user.
+func ValidateResponseURL(u *url.URL, allowed []string) error {
+	if u != nil {
+		for _, a := range allowed {
+			au, err := url.Parse(a)
+			if err != nil {
+				return err
+			}
+
+			if strings.EqualFold(u.Scheme, au.Scheme) && strings.EqualFold(u.Host, au.Host) {
+				return nil
+			}
+		}
+	}
+
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Message: "Invalid response_url.",
+		Err:     &InvalidResponseURLError{URL: u},
+	}
+}
+
+// ParseRequest parses the form an then returns the extracted Command. The
+// response_url isn't validated, see ParseAndValidateRequest.
 func ParseRequest(r *http.Request) (Command, error) {
 	err := r.ParseForm()
 	if err != nil {
@@ -113,6 +292,26 @@ func ParseRequest(r *http.Request) (Command, error) {
 
 }
 
+// ParseAndValidateRequest is like ParseRequest, but also checks that the
+// response_url matches one of the allowed schemes and hosts with
+// ValidateResponseURL. If allowed is nil, DefaultAllowedResponseURLs is used.
+func ParseAndValidateRequest(r *http.Request, allowed []string) (Command, error) {
+	command, err := ParseRequest(r)
+	if err != nil {
+		return Command{}, err
+	}
+
+	if allowed == nil {
+		allowed = DefaultAllowedResponseURLs
+	}
+
+	if err := ValidateResponseURL(command.ResponseURL, allowed); err != nil {
+		return Command{}, err
+	}
+
+	return command, nil
+}
+
 // Params returns the match groups from a regular expression match.
 func Params(ctx context.Context) map[string]string {
 	params, ok := ctx.Value(paramsKey).(map[string]string)
@@ -122,13 +321,63 @@ func Params(ctx context.Context) map[string]string {
 	return params
 }
 
+// WithParams returns a new context.Context with the match groups set.
 func WithParams(ctx context.Context, params map[string]string) context.Context {
 	return context.WithValue(ctx, paramsKey, params)
 }
 
+// ReceivedAt returns the time that the command was received by the Server.
+func ReceivedAt(ctx context.Context) time.Time {
+	t, _ := ctx.Value(receivedAtKey).(time.Time)
+	return t
+}
+
+// WithReceivedAt returns a new context.Context with the receive time set.
+func WithReceivedAt(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, receivedAtKey, t)
+}
+
+// RequestID returns the unique id that the Server generated for the command.
+// This is useful for correlating log messages.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithRequestID returns a new context.Context with the request id set.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// Path returns the subcommands that were consumed by mounted handlers to reach
+// the current Handler. For example, a Handler mounted at "db" on a Mux that's
+// mounted at "ops" would get []string{"ops", "db"}.
+func Path(ctx context.Context) []string {
+	path, _ := ctx.Value(pathKey).([]string)
+	return path
+}
+
+// WithPath returns a new context.Context with the subcommand path set.
+func WithPath(ctx context.Context, path []string) context.Context {
+	return context.WithValue(ctx, pathKey, path)
+}
+
+// newRequestID generates a random request id.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Should never happen
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
 // key used to store context values from within this package.
 type key int
 
 const (
-	paramsKey key = 0
+	paramsKey key = iota
+	receivedAtKey
+	requestIDKey
+	pathKey
 )
@@ -1,10 +1,12 @@
 package slash
 
 import (
+	"errors"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -36,6 +38,7 @@ func TestCommandFromValues(t *testing.T) {
 		Command:     "/deploy",
 		Text:        "acme-inc to staging",
 		ResponseURL: u,
+		raw:         req.Form.Encode(),
 	}, cmd)
 }
 
@@ -59,9 +62,141 @@ func TestParseRequest(t *testing.T) {
 		Command:     "/deploy",
 		Text:        "acme-inc to staging",
 		ResponseURL: u,
+		raw:         req.Form.Encode(),
 	})
 }
 
+func TestCommandFromValues_Enterprise(t *testing.T) {
+	v, err := url.ParseQuery(testForm + `&enterprise_id=E0001&enterprise_name=Globular%20Construct%20Inc&is_enterprise_install=true&api_app_id=A123456&trigger_id=13345224609.738474920.8088930838d88f008e0&foo=bar`)
+	assert.NoError(t, err)
+
+	cmd, err := CommandFromValues(v)
+	assert.NoError(t, err)
+	assert.Equal(t, "E0001", cmd.EnterpriseID)
+	assert.Equal(t, "Globular Construct Inc", cmd.EnterpriseName)
+	assert.True(t, cmd.IsEnterpriseInstall)
+	assert.Equal(t, "A123456", cmd.APIAppID)
+	assert.Equal(t, "13345224609.738474920.8088930838d88f008e0", cmd.TriggerID)
+	assert.Equal(t, "bar", cmd.RawValues().Get("foo"))
+
+	// Changes to the raw values shouldn't affect the Command or the
+	// original values.
+	cmd.RawValues().Set("foo", "baz")
+	v.Set("foo", "qux")
+	assert.Equal(t, "bar", cmd.RawValues().Get("foo"))
+}
+
+func TestCommand_Comparable(t *testing.T) {
+	v, err := url.ParseQuery(testForm)
+	assert.NoError(t, err)
+
+	a, err := CommandFromValues(v)
+	assert.NoError(t, err)
+	b := a
+
+	assert.True(t, a == b)
+
+	seen := map[Command]bool{a: true}
+	assert.True(t, seen[b])
+}
+
+func TestValuesFromCommand(t *testing.T) {
+	v, err := url.ParseQuery(testForm + `&enterprise_id=E0001&is_enterprise_install=false&trigger_id=1234&foo=bar`)
+	assert.NoError(t, err)
+
+	cmd, err := CommandFromValues(v)
+	assert.NoError(t, err)
+	assert.Equal(t, v, ValuesFromCommand(cmd))
+
+	cmd.TriggerID = ""
+	cmd.IsEnterpriseInstall = true
+	got := ValuesFromCommand(cmd)
+	assert.Equal(t, "", got.Get("trigger_id"))
+	assert.Equal(t, "true", got.Get("is_enterprise_install"))
+	assert.Equal(t, "bar", got.Get("foo"))
+}
+
+func TestValidateResponseURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed []string
+		ok      bool
+	}{
+		{"https://hooks.slack.com/commands/1234/5678", DefaultAllowedResponseURLs, true},
+		{"HTTPS://HOOKS.SLACK.COM/commands/1234/5678", DefaultAllowedResponseURLs, true},
+		{"http://hooks.slack.com/commands/1234/5678", DefaultAllowedResponseURLs, false},
+		{"https://hooks.slack.com.evil.com/commands", DefaultAllowedResponseURLs, false},
+		{"https://evil.com/?https://hooks.slack.com", DefaultAllowedResponseURLs, false},
+		{"", DefaultAllowedResponseURLs, false},
+		{"http://127.0.0.1:8080/", []string{"http://127.0.0.1:8080"}, true},
+		{"http://127.0.0.1:8081/", []string{"http://127.0.0.1:8080"}, false},
+	}
+
+	for _, tt := range tests {
+		u := mustURL(tt.url)
+		err := ValidateResponseURL(u, tt.allowed)
+		if tt.ok {
+			assert.NoError(t, err, tt.url)
+		} else {
+			var uerr *InvalidResponseURLError
+			assert.True(t, errors.As(err, &uerr), tt.url)
+			assert.Equal(t, &InvalidResponseURLError{URL: u}, uerr, tt.url)
+			assert.Equal(t, "Invalid response_url.", UserMessage(err), tt.url)
+			assert.Equal(t, http.StatusBadRequest, StatusCode(err), tt.url)
+		}
+	}
+
+	var uerr *InvalidResponseURLError
+	assert.True(t, errors.As(ValidateResponseURL(nil, DefaultAllowedResponseURLs), &uerr))
+}
+
+func TestParseAndValidateRequest(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	command, err := ParseAndValidateRequest(req, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/deploy", command.Command)
+
+	req, _ = http.NewRequest("POST", "/", strings.NewReader(testForm))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	_, err = ParseAndValidateRequest(req, []string{"https://example.com"})
+	var uerr *InvalidResponseURLError
+	assert.True(t, errors.As(err, &uerr))
+}
+
+func TestCommand_ChannelType(t *testing.T) {
+	assert.True(t, Command{ChannelName: "directmessage"}.IsDirectMessage())
+	assert.True(t, Command{ChannelName: "privategroup"}.IsPrivateChannel())
+	assert.True(t, Command{ChannelName: "mpdm-ejholmes--bob-1"}.IsMultiPartyDirectMessage())
+
+	c := Command{ChannelName: "general"}
+	assert.False(t, c.IsDirectMessage())
+	assert.False(t, c.IsPrivateChannel())
+	assert.False(t, c.IsMultiPartyDirectMessage())
+}
+
+func TestReceivedAt(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, ReceivedAt(ctx).IsZero())
+
+	now := time.Now()
+	ctx = WithReceivedAt(ctx, now)
+	assert.Equal(t, now, ReceivedAt(ctx))
+}
+
+func TestRequestID(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "", RequestID(ctx))
+
+	ctx = WithRequestID(ctx, "abcd")
+	assert.Equal(t, "abcd", RequestID(ctx))
+
+	assert.Len(t, newRequestID(), 32)
+	assert.NotEqual(t, newRequestID(), newRequestID())
+}
+
 type mockHandler struct {
 	mock.Mock
 }
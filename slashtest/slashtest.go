@@ -2,12 +2,15 @@
 package slashtest
 
 import (
+	"bytes"
 	"encoding/json"
-	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ejholmes/slash"
 )
@@ -43,22 +46,69 @@ func (r *ResponseRecorder) Respond(resp slash.Response) error {
 // can be used in combination with httptest.Server to record responses posted to
 // Slack.
 func (r *ResponseRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var resp slash.Response
-	if err := json.NewDecoder(req.Body).Decode(&resp); err != nil {
+	var raw struct {
+		ResponseType string             `json:"response_type"`
+		Text         string             `json:"text"`
+		Attachments  []slash.Attachment `json:"attachments"`
+		Blocks       []json.RawMessage  `json:"blocks"`
+
+		ReplaceOriginal bool `json:"replace_original"`
+		DeleteOriginal  bool `json:"delete_original"`
+
+		ThreadTS    string `json:"thread_ts"`
+		Mrkdwn      *bool  `json:"mrkdwn"`
+		UnfurlLinks *bool  `json:"unfurl_links"`
+		UnfurlMedia *bool  `json:"unfurl_media"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&raw); err != nil {
 		panic(err)
 	}
 
+	resp := slash.Response{
+		InChannel:   raw.ResponseType == "in_channel",
+		Text:        raw.Text,
+		Attachments: raw.Attachments,
+
+		ReplaceOriginal: raw.ReplaceOriginal,
+		DeleteOriginal:  raw.DeleteOriginal,
+
+		ThreadTS:    raw.ThreadTS,
+		Mrkdwn:      raw.Mrkdwn,
+		UnfurlLinks: raw.UnfurlLinks,
+		UnfurlMedia: raw.UnfurlMedia,
+	}
+	for _, b := range raw.Blocks {
+		resp.Blocks = append(resp.Blocks, RawBlock(b))
+	}
 	if err := r.add(resp); err != nil {
 		panic(err)
 	}
 }
 
+// RawBlock is a Block Kit block recorded by a ResponseRecorder, as the JSON
+// that was posted to the response_url.
+type RawBlock json.RawMessage
+
+// BlockType returns the type of the block.
+func (b RawBlock) BlockType() string {
+	var raw struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(b, &raw)
+	return raw.Type
+}
+
+// MarshalJSON returns the JSON of the block as it was recorded.
+func (b RawBlock) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(b).MarshalJSON()
+}
+
 func (r *ResponseRecorder) add(resp slash.Response) error {
 	select {
 	case r.ch <- resp:
 		return nil
 	default:
-		return fmt.Errorf("you can send a maximum of %d delayed responses", cap(r.ch))
+		return slash.ErrTooManyResponses
 	}
 }
 
@@ -104,3 +154,24 @@ func NewRequest(method, path string, cmd slash.Command) (*http.Request, error) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	return req, nil
 }
+
+// SignRequest signs the request with the given signing secret, setting the
+// X-Slack-Signature and X-Slack-Request-Timestamp headers, so that it passes
+// verification by a slash.Server with a SigningSecret.
+func SignRequest(req *http.Request, secret string) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body.Close()
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	ts := time.Now().Unix()
+	req.Header.Set(slash.TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(slash.SignatureHeader, slash.Signature(secret, ts, body))
+	return nil
+}
@@ -1,8 +1,13 @@
 package slashtest_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
 	"time"
 
 	"golang.org/x/net/context"
@@ -12,25 +17,74 @@ import (
 )
 
 func ExampleServer() {
-	// A slash.Handler that will handle our slash commands.
+	// A slash.Handler that will handle our slash commands. The first
+	// response is written directly to the http response, and the second is
+	// posted to the response_url.
 	h := slash.NewServer(slash.HandlerFunc(func(ctx context.Context, r slash.Responder, c slash.Command) error {
-		return r.Respond(slash.Reply("Hey"))
+		if err := r.Respond(slash.Reply("Hey")); err != nil {
+			return err
+		}
+		return r.Respond(slash.Reply("Ho"))
 	}))
 
 	// Responses from the above handler will be posted here.
 	responses := slashtest.NewServer()
 	defer responses.Close()
+	h.AllowedResponseURLs = []string{responses.URL}
 
 	req, _ := slashtest.NewRequest("POST", "/", responses.NewCommand())
 	resp := httptest.NewRecorder()
 
 	h.ServeHTTP(resp, req)
 
+	var immediate slash.Response
+	if err := json.NewDecoder(resp.Body).Decode(&immediate); err != nil {
+		panic(err)
+	}
+	fmt.Println(immediate.Text)
+
 	select {
 	case resp := <-responses.Responses:
 		fmt.Println(resp.Text)
-		// Output: Hey
 	case <-time.After(time.Second):
 		panic("timeout")
 	}
+
+	// Output:
+	// Hey
+	// Ho
+}
+
+func TestSignRequest(t *testing.T) {
+	req, _ := slashtest.NewRequest("POST", "/", slash.Command{ResponseURL: &url.URL{}})
+	if err := slashtest.SignRequest(req, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := slash.VerifyRequest(req, "secret", slash.DefaultMaxClockSkew); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResponseRecorder_Blocks(t *testing.T) {
+	r := slashtest.NewRecorder()
+
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(`{"text":"Deploy","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"*acme-inc*"}}]}`))
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	resp := <-r.Responses
+	if len(resp.Blocks) != 1 {
+		t.Fatalf("expected 1 block, got %d", len(resp.Blocks))
+	}
+	if got := resp.Blocks[0].BlockType(); got != "section" {
+		t.Fatalf("expected a section block, got %q", got)
+	}
+
+	raw, err := json.Marshal(resp.Blocks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(raw), `{"type":"section","text":{"type":"mrkdwn","text":"*acme-inc*"}}`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
 }
@@ -0,0 +1,226 @@
+package slash
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// The delimiter for code blocks in mrkdwn.
+const codeFence = "```"
+
+// Splitter is a Responder that splits responses with text longer than
+// MaxLength into multiple responses, on line boundaries. Code blocks that span
+// multiple responses are closed at the end of one, and re-opened at the start
+// of the next.
+type Splitter struct {
+	Responder
+
+	// MaxLength is the maximum length of the text in each response. The
+	// zero value means MaximumTextLength.
+	MaxLength int
+
+	// Held while sending the chunks of a response, so that they aren't
+	// interleaved with another one.
+	mu sync.Mutex
+}
+
+// NewSplitter returns a new Splitter that sends responses with r.
+func NewSplitter(r Responder) *Splitter {
+	return &Splitter{
+		Responder: r,
+	}
+}
+
+// Respond sends the Response, split into as many responses as needed. If the
+// Responder doesn't have enough responses remaining, as many chunks as possible
+// are sent and a *TruncatedError is returned. If none can be sent,
+// ErrTooManyResponses is returned.
+func (s *Splitter) Respond(resp Response) error {
+	max := s.MaxLength
+	if max == 0 {
+		max = MaximumTextLength
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chunks := SplitText(resp.Text, max)
+	n := len(chunks)
+	if left := remaining(s.Responder); left >= 0 && n > left {
+		n = left
+	}
+
+	if n == 0 {
+		return ErrTooManyResponses
+	}
+
+	for i, chunk := range chunks[:n] {
+		r := resp
+		r.Text = chunk
+		if i > 0 {
+			// Only the first response carries the rest of the
+			// message, and the rest are sent as new messages.
+			r.Blocks = nil
+			r.Attachments = nil
+			r.ReplaceOriginal = false
+		}
+
+		if err := s.Responder.Respond(r); err != nil {
+			if err == ErrTooManyResponses && i > 0 {
+				n = i
+				break
+			}
+			return err
+		}
+	}
+
+	if n < len(chunks) {
+		var dropped int
+		for _, chunk := range chunks[n:] {
+			dropped += utf8.RuneCountInString(chunk)
+		}
+		return &TruncatedError{
+			Sent:    n,
+			Total:   len(chunks),
+			Dropped: dropped,
+		}
+	}
+
+	return nil
+}
+
+// TruncatedError is returned by Splitter when the text of a Response didn't
+// fit in the remaining responses.
+type TruncatedError struct {
+	// The number of chunks that were sent, out of the Total.
+	Sent, Total int
+
+	// The number of characters that were dropped.
+	Dropped int
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("slash: response truncated: sent %d of %d chunks, dropped %d characters", e.Sent, e.Total, e.Dropped)
+}
+
+// SplitText splits text into chunks of at most max characters, on line
+// boundaries where possible. Code blocks that are split are closed at the end
+// of a chunk, and re-opened at the start of the next one.
+func SplitText(text string, max int) []string {
+	if utf8.RuneCountInString(text) <= max {
+		return []string{text}
+	}
+
+	// Lines are split further if they're too long to fit in a chunk along
+	// with the fences needed to close and re-open a code block.
+	const reserve = len(codeFence+"\n") + len("\n"+codeFence)
+	width := max
+	if max > 2*reserve {
+		width = max - reserve
+	}
+
+	var (
+		chunks []string
+		cur    strings.Builder
+		curLen int
+		// true if nothing, besides a re-opened code block, has been
+		// added to the current chunk.
+		empty = true
+		// true if the current position is inside of a code block.
+		open bool
+	)
+
+	flush := func() {
+		chunk := strings.TrimRight(cur.String(), "\n")
+		if open {
+			chunk += "\n" + codeFence
+		}
+		chunks = append(chunks, chunk)
+
+		cur.Reset()
+		curLen = 0
+		empty = true
+		if open {
+			cur.WriteString(codeFence)
+			curLen = len(codeFence)
+		}
+	}
+
+	for _, p := range splitLines(text, width) {
+		var sep string
+		if !p.cont && curLen > 0 {
+			sep = "\n"
+		}
+
+		openAfter := open != (strings.Count(p.text, codeFence)%2 == 1)
+		need := len(sep) + utf8.RuneCountInString(p.text)
+		if openAfter {
+			need += len("\n" + codeFence)
+		}
+
+		if !empty && curLen+need > max {
+			flush()
+			if curLen > 0 {
+				sep = "\n"
+			} else {
+				sep = ""
+			}
+		}
+
+		cur.WriteString(sep)
+		cur.WriteString(p.text)
+		curLen += len(sep) + utf8.RuneCountInString(p.text)
+		empty = false
+		open = openAfter
+	}
+
+	if !empty {
+		chunks = append(chunks, strings.TrimRight(cur.String(), "\n"))
+	}
+
+	return chunks
+}
+
+// line is a line of text, or a part of one.
+type line struct {
+	text string
+
+	// true if this is a continuation of the previous line.
+	cont bool
+}
+
+// splitLines splits text into lines, without the trailing newline. Lines
+// longer than max characters are split further, but never inside of a run of
+// backticks, so that code fences stay whole.
+func splitLines(text string, max int) []line {
+	var lines []line
+	for _, l := range strings.Split(text, "\n") {
+		cont := false
+		for utf8.RuneCountInString(l) > max {
+			i := 0
+			for j := 0; j < max; j++ {
+				_, size := utf8.DecodeRuneInString(l[i:])
+				i += size
+			}
+			if l[i-1] == '`' && l[i] == '`' {
+				j := strings.LastIndexFunc(l[:i], func(r rune) bool { return r != '`' }) + 1
+				if j == 0 {
+					// The line starts with the run of backticks,
+					// so keep all of it in this part.
+					j = i + strings.IndexFunc(l[i:], func(r rune) bool { return r != '`' })
+					if j < i {
+						j = len(l)
+					}
+				}
+				i = j
+			}
+			lines = append(lines, line{text: l[:i], cont: cont})
+			l = l[i:]
+			cont = true
+		}
+		lines = append(lines, line{text: l, cont: cont})
+	}
+	return lines
+}
@@ -0,0 +1,136 @@
+package slash
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		text   string
+		max    int
+		chunks []string
+	}{
+		{"", 10, []string{""}},
+		{"short", 10, []string{"short"}},
+		{"aaaa\nbbbb\ncccc", 10, []string{"aaaa\nbbbb", "cccc"}},
+		{"aaaa\nbbbb\ncccc\n", 10, []string{"aaaa\nbbbb", "cccc"}},
+		{strings.Repeat("a", 25), 20, []string{strings.Repeat("a", 12), strings.Repeat("a", 13)}},
+		{"ééééé\nééééé", 6, []string{"ééééé", "ééééé"}},
+
+		// Code blocks are closed and re-opened.
+		{"```\naaaa\nbbbb\ncccc\n```", 18, []string{"```\naaaa\nbbbb\n```", "```\ncccc\n```"}},
+		{"log:\n```\naaaa\n```\nbbbb", 17, []string{"log:\n```\naaaa\n```", "bbbb"}},
+		{"log:\n```\naaaa\nbbbb\n```\ncccc", 17, []string{"log:\n```\naaaa\n```", "```\nbbbb\n```\ncccc"}},
+
+		// Long lines aren't wrapped inside of a code fence.
+		{"abbbb\n ccccccccccbbaécccccccccc```\n bbbb```\n \n", 21, []string{"abbbb\n ccccccccccbb", "aécccccccccc```\n```", "```\n bbbb```\n "}},
+	}
+
+	for _, tt := range tests {
+		chunks := SplitText(tt.text, tt.max)
+		assert.Equal(t, tt.chunks, chunks, "SplitText(%q, %d)", tt.text, tt.max)
+		for _, chunk := range chunks {
+			assert.True(t, utf8.RuneCountInString(chunk) <= tt.max, "chunk %q is longer than %d", chunk, tt.max)
+			assert.True(t, strings.Count(chunk, codeFence)%2 == 0, "chunk %q has an unbalanced code fence", chunk)
+		}
+	}
+}
+
+func TestSplitter(t *testing.T) {
+	r := new(recordingResponder)
+	s := NewSplitter(r)
+	s.MaxLength = 10
+
+	resp := Say("aaaa\nbbbb\ncccc")
+	resp.Attachments = []Attachment{{Text: "attachment"}}
+	err := s.Respond(resp)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Response{
+		{InChannel: true, Text: "aaaa\nbbbb", Attachments: []Attachment{{Text: "attachment"}}},
+		{InChannel: true, Text: "cccc"},
+	}, r.responses())
+}
+
+func TestSplitter_Truncated(t *testing.T) {
+	r := &budgetedResponder{recordingResponder: new(recordingResponder), max: 2}
+	s := NewSplitter(r)
+	s.MaxLength = 4
+
+	err := s.Respond(Reply("aaaa\nbbbb\ncccc\ndd"))
+	assert.Equal(t, &TruncatedError{Sent: 2, Total: 4, Dropped: 6}, err)
+	assert.EqualError(t, err, "slash: response truncated: sent 2 of 4 chunks, dropped 6 characters")
+
+	assert.Equal(t, []Response{
+		{Text: "aaaa"},
+		{Text: "bbbb"},
+	}, r.responses())
+
+	err = s.Respond(Reply("eeee"))
+	assert.Equal(t, ErrTooManyResponses, err)
+}
+
+func TestSplitter_Truncated_TooManyResponses(t *testing.T) {
+	// A Responder that doesn't report its budget.
+	s := NewSplitter(&limitedResponder{max: 2})
+	s.MaxLength = 4
+
+	err := s.Respond(Reply("aaaa\nbbbb\ncccc\ndd"))
+	assert.Equal(t, &TruncatedError{Sent: 2, Total: 4, Dropped: 6}, err)
+
+	err = s.Respond(Reply("eeee"))
+	assert.Equal(t, ErrTooManyResponses, err)
+}
+
+func TestSplitter_Responder(t *testing.T) {
+	var posts int
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+	}))
+	defer rs.Close()
+
+	r := NewResponder(context.Background(), Command{ResponseURL: mustURL(rs.URL)}, nil, []string{rs.URL})
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.Respond(Reply("working")))
+	}
+
+	s := NewSplitter(r)
+	s.MaxLength = 4
+
+	err := s.Respond(Reply("aaaa\nbbbb\ncccc\ndd"))
+	assert.Equal(t, &TruncatedError{Sent: 2, Total: 4, Dropped: 6}, err)
+	assert.Equal(t, MaximumDelayedResponses, posts)
+}
+
+// budgetedResponder is a recordingResponder that can send a limited number of
+// responses.
+type budgetedResponder struct {
+	*recordingResponder
+	max int
+}
+
+func (r *budgetedResponder) Remaining() int {
+	return r.max - len(r.responses())
+}
+
+// limitedResponder is a Responder that returns ErrTooManyResponses after max
+// responses, without implementing Budgeted.
+type limitedResponder struct {
+	max, sent int
+}
+
+func (r *limitedResponder) Respond(resp Response) error {
+	if r.sent >= r.max {
+		return ErrTooManyResponses
+	}
+	r.sent++
+	return nil
+}
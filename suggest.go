@@ -0,0 +1,200 @@
+package slash
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/context"
+)
+
+// MaximumSuggestions is the maximum number of subcommands that are suggested
+// by the Suggest handler.
+const MaximumSuggestions = 3
+
+// Suggest returns a Handler, used as the default NotFound Handler of the Mux,
+// that replies with the subcommands of the Mux that are closest to the first
+// argument in the text of the command. If the Mux has no subcommands, like a
+// Mux of Command routes, it replies with the closest commands instead. If the
+// Mux has a Help route, the reply also points to it.
+func (m *Mux) Suggest() Handler {
+	return &suggester{mux: m}
+}
+
+// suggester is a Handler that suggests subcommands of a Mux.
+type suggester struct {
+	mux *Mux
+}
+
+func (s *suggester) ServeCommand(ctx context.Context, r Responder, command Command) error {
+	cmd := strings.Join(append([]string{command.Command}, Path(ctx)...), " ")
+
+	subcommands := s.mux.subcommands()
+
+	var text string
+	if len(subcommands) == 0 {
+		text = fmt.Sprintf("Sorry, I don't know how to handle `%s`.", cmd)
+
+		var suggestions []string
+		for _, suggestion := range suggest(command.Command, s.mux.commands()) {
+			suggestions = append(suggestions, fmt.Sprintf("`%s`", suggestion))
+		}
+		text += didYouMean(suggestions)
+	} else if subcmd, _, ok := shift(command.Text); ok {
+		text = fmt.Sprintf("Sorry, I don't know how to handle `%s %s`.", cmd, subcmd)
+
+		var suggestions []string
+		for _, suggestion := range suggest(subcmd, subcommands) {
+			suggestions = append(suggestions, fmt.Sprintf("`%s %s`", cmd, suggestion))
+		}
+		text += didYouMean(suggestions)
+	} else {
+		text = fmt.Sprintf("Sorry, `%s` needs a subcommand.", cmd)
+	}
+
+	if s.mux.hasHelp() {
+		text += fmt.Sprintf(" Try `%s %s` for a list of commands.", cmd, helpSubcommand)
+	}
+
+	return r.Respond(Reply(text))
+}
+
+// subcommands returns the subcommands that the routes in the Mux match: the
+// subcommand for Mount routes, and the leading literal word for Pattern
+// routes.
+func (m *Mux) subcommands() []string {
+	var subcommands []string
+	seen := make(map[string]bool)
+
+	for _, r := range m.routes {
+		var subcmd string
+		if mt, ok := r.Handler.(*mount); ok {
+			subcmd = mt.subcommand
+		} else if p, ok := r.Matcher.(*Pattern); ok && len(p.segments) > 0 && p.segments[0].kind == literalSegment {
+			subcmd = p.segments[0].value
+		}
+
+		if subcmd != "" && !seen[subcmd] {
+			seen[subcmd] = true
+			subcommands = append(subcommands, subcmd)
+		}
+	}
+
+	return subcommands
+}
+
+// commands returns the commands that the Command routes in the Mux match.
+func (m *Mux) commands() []string {
+	var commands []string
+	seen := make(map[string]bool)
+
+	for _, r := range m.routes {
+		if c, ok := r.Matcher.(commandMatcher); ok && !seen[string(c)] {
+			seen[string(c)] = true
+			commands = append(commands, string(c))
+		}
+	}
+
+	return commands
+}
+
+// hasHelp returns true if the Help route was added to the Mux.
+func (m *Mux) hasHelp() bool {
+	for _, r := range m.routes {
+		if mt, ok := r.Handler.(*mount); ok {
+			if _, ok := mt.handler.(*helpHandler); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// suggest returns up to MaximumSuggestions candidates that are within a small
+// edit distance of s, closest first.
+func suggest(s string, candidates []string) []string {
+	type suggestion struct {
+		candidate string
+		distance  int
+	}
+
+	// Allow roughly one typo for every three characters, so that short
+	// inputs don't match every short candidate.
+	max := (utf8.RuneCountInString(s) + 2) / 3
+
+	var suggestions []suggestion
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(s), strings.ToLower(c)); d <= max {
+			suggestions = append(suggestions, suggestion{c, d})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+
+	var result []string
+	for i := 0; i < len(suggestions) && i < MaximumSuggestions; i++ {
+		result = append(result, suggestions[i].candidate)
+	}
+	return result
+}
+
+// editDistance returns the number of single character insertions, deletions,
+// substitutions and transpositions of adjacent characters needed to change a
+// into b. This is the Levenshtein distance, with transpositions counted as one
+// edit, since they're a common typo.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// The last three rows of the distance matrix.
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if d := prev2[j-2] + 1; d < cur[j] {
+					cur[j] = d
+				}
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+// didYouMean returns a sentence offering the suggestions, or an empty string if
+// there are none.
+func didYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" Did you mean %s?", joinOr(suggestions))
+}
+
+// joinOr joins the words into a list like "a, b or c".
+func joinOr(words []string) string {
+	if len(words) == 1 {
+		return words[0]
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " or " + words[len(words)-1]
+}
@@ -0,0 +1,148 @@
+package slash
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMux_NotFound(t *testing.T) {
+	r := new(mockResponder)
+	h := new(mockHandler)
+	m := NewMux()
+	m.NotFound = h
+
+	cmd := Command{
+		Command: "/deploy",
+	}
+
+	ctx := context.Background()
+	h.On("ServeCommand", ctx, r, cmd).Return(Reply(""), nil)
+
+	err := m.ServeCommand(ctx, r, cmd)
+	assert.NoError(t, err)
+
+	h.AssertExpectations(t)
+}
+
+func TestMux_Suggest(t *testing.T) {
+	h := new(mockHandler)
+
+	db := NewMux()
+	db.Pattern("migrate {app}", h)
+
+	ops := NewMux()
+	ops.Pattern("deploy {repo} [to {env}]", h)
+	ops.Pattern("deploy-status {repo}", h)
+	ops.Pattern("{app} logs", h)
+	ops.Mount("db", db)
+	ops.Help()
+
+	m := NewMux()
+	m.Mount("ops", ops)
+
+	tests := []struct {
+		text     string
+		response string
+	}{
+		{"ops deplyo acme-inc", "Sorry, I don't know how to handle `/cmd ops deplyo`. Did you mean `/cmd ops deploy`? Try `/cmd ops help` for a list of commands."},
+		{"ops DB", "Sorry, I don't know how to handle `/cmd ops DB`. Did you mean `/cmd ops db`? Try `/cmd ops help` for a list of commands."},
+		{"ops deploystatus", "Sorry, I don't know how to handle `/cmd ops deploystatus`. Did you mean `/cmd ops deploy-status`? Try `/cmd ops help` for a list of commands."},
+		{"ops hepl", "Sorry, I don't know how to handle `/cmd ops hepl`. Did you mean `/cmd ops help`? Try `/cmd ops help` for a list of commands."},
+		{"ops restart", "Sorry, I don't know how to handle `/cmd ops restart`. Try `/cmd ops help` for a list of commands."},
+		{"ops", "Sorry, `/cmd ops` needs a subcommand. Try `/cmd ops help` for a list of commands."},
+	}
+
+	for _, tt := range tests {
+		r := new(mockResponder)
+		r.On("Respond", Reply(tt.response)).Return(nil)
+
+		err := m.ServeCommand(context.Background(), r, Command{Command: "/cmd", Text: tt.text})
+		assert.NoError(t, err, tt.text)
+
+		r.AssertExpectations(t)
+	}
+
+	// Mounted Muxes suggest their own subcommands.
+	r := new(mockResponder)
+	r.On("Respond", Reply("Sorry, I don't know how to handle `/cmd ops db migrat`. Did you mean `/cmd ops db migrate`?")).Return(nil)
+
+	err := m.ServeCommand(context.Background(), r, Command{Command: "/cmd", Text: "ops db migrat acme-inc"})
+	assert.NoError(t, err)
+
+	r.AssertExpectations(t)
+}
+
+func TestMux_Suggest_NoHelp(t *testing.T) {
+	r := new(mockResponder)
+	m := NewMux()
+	m.Mount("deploy", new(mockHandler))
+
+	r.On("Respond", Reply("Sorry, I don't know how to handle `/ops depoly`. Did you mean `/ops deploy`?")).Return(nil)
+
+	err := m.ServeCommand(context.Background(), r, Command{Command: "/ops", Text: "depoly"})
+	assert.NoError(t, err)
+
+	r.AssertExpectations(t)
+}
+
+func TestMux_Suggest_Commands(t *testing.T) {
+	m := NewMux()
+	m.Command("/weather", "token", new(mockHandler))
+	m.Command("/deploy", "token", new(mockHandler))
+
+	tests := []struct {
+		command  string
+		text     string
+		response string
+	}{
+		{"/waether", "zip 94102", "Sorry, I don't know how to handle `/waether`. Did you mean `/weather`?"},
+		{"/deplyo", "acme-inc to staging", "Sorry, I don't know how to handle `/deplyo`. Did you mean `/deploy`?"},
+		{"/ops", "restart", "Sorry, I don't know how to handle `/ops`."},
+	}
+
+	for _, tt := range tests {
+		r := new(mockResponder)
+		r.On("Respond", Reply(tt.response)).Return(nil)
+
+		err := m.ServeCommand(context.Background(), r, Command{Token: "token", Command: tt.command, Text: tt.text})
+		assert.NoError(t, err, tt.command)
+
+		r.AssertExpectations(t)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"deploy", "db", "help", "logs", "status"}
+
+	assert.Equal(t, []string{"deploy"}, suggest("deplyo", candidates))
+	assert.Equal(t, []string{"db"}, suggest("d", candidates))
+	assert.Equal(t, []string{"abcde", "abcdef"}, suggest("abcd", []string{"abcdef", "abcde", "abcdefg"}))
+	assert.Nil(t, suggest("x", []string{"db", "up"}))
+	assert.Equal(t, []string{"status"}, suggest("STATUS", candidates))
+	assert.Nil(t, suggest("restart", candidates))
+	assert.Len(t, suggest("x", []string{"a", "b", "c", "d"}), MaximumSuggestions)
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"deploy", "deploy", 0},
+		{"deplyo", "deploy", 1},
+		{"ab", "ba", 1},
+		{"abc", "ca", 3},
+		{"kitten", "sitting", 3},
+		{"héllo", "hello", 1},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.distance, editDistance(tt.a, tt.b), "%q %q", tt.a, tt.b)
+	}
+}